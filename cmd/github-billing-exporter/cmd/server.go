@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/nashiox/github-billing-exporter/pkg/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,10 +31,29 @@ func serverCmd() *cobra.Command {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetBool("check-config") {
+				if err := serverArgs.Validate(); err != nil {
+					return xerrors.Errorf("invalid configuration: %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+				return nil
+			}
+
 			return server.Run(serverArgs)
 		},
 	}
 
+	serverCmd.PersistentFlags().String(
+		"config",
+		"",
+		"Config File with the Options Keyed by their Flag Names, e.g. config.yaml",
+	)
+	serverCmd.PersistentFlags().Bool(
+		"check-config",
+		false,
+		"Validate the Configuration and Exit without Starting the Server",
+	)
+
 	serverCmd.PersistentFlags().IntVarP(
 		&serverArgs.Port,
 		"port",
@@ -36,6 +61,36 @@ func serverCmd() *cobra.Command {
 		9999,
 		"Exporter Listen Port",
 	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.AdminListenAddress,
+		"admin-listen-address",
+		"",
+		"Address to Serve /healthz, /readyz, /refresh and /debug/pprof on instead of the Exporter Port, e.g. 127.0.0.1:9998",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.ReadyOnRateLimit,
+		"ready-on-rate-limit",
+		false,
+		"Fail /readyz while a Rate Limit of Every Owner is Nearly Exhausted",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.ReadyRateLimitThreshold,
+		"ready-rate-limit-threshold",
+		100,
+		"Remaining Requests or Points below which /readyz Fails",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.Debug,
+		"debug",
+		false,
+		"Enable Debug Logging",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.LogScrapeResults,
+		"log-scrape-results",
+		false,
+		"Log a Summary of the Billing Values of Every Cycle",
+	)
 	serverCmd.PersistentFlags().IntVarP(
 		&serverArgs.Refresh,
 		"refresh",
@@ -43,19 +98,80 @@ func serverCmd() *cobra.Command {
 		300,
 		"Refresh Interval Secounds",
 	)
-	serverCmd.PersistentFlags().StringVarP(
+	serverCmd.PersistentFlags().Float64Var(
+		&serverArgs.RefreshJitter,
+		"refresh-jitter",
+		0,
+		"Fraction to Randomly Lengthen or Shorten Each Refresh Interval by, e.g. 0.1 for ±10%",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.Schedule,
+		"schedule",
+		"",
+		"Cron Expression to Collect on instead of the Refresh Interval, e.g. \"0 * * * *\"",
+	)
+	serverCmd.PersistentFlags().DurationVar(
+		&serverArgs.ScrapeTimeout,
+		"scrape-timeout",
+		time.Minute,
+		"Timeout of a Collection Cycle",
+	)
+	// Decoded into serverArgs.OwnerScrapeTimeouts by viper, pflag has no map
+	// of durations.
+	serverCmd.PersistentFlags().StringToString(
+		"owner-scrape-timeouts",
+		nil,
+		"Scrape Timeouts of Owners Overriding the Scrape Timeout, e.g. ghes-enterprise=3m",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.Retries,
+		"retries",
+		2,
+		"Retries of a Request Failing with a Transient Error within a Cycle",
+	)
+	serverCmd.PersistentFlags().IntSliceVar(
+		&serverArgs.RetryableStatusCodes,
+		"retryable-status-codes",
+		[]int{429, 500, 502, 503, 504},
+		"HTTP Status Codes Treated as Transient Errors",
+	)
+	serverCmd.PersistentFlags().StringSliceVarP(
 		&serverArgs.Organization,
 		"organization",
 		"o",
-		"",
-		"GitHub Organization Name",
+		nil,
+		"GitHub Organization Names",
 	)
-	serverCmd.PersistentFlags().StringVarP(
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.AutoDiscoverOrgs,
+		"auto-discover-orgs",
+		false,
+		"Collect the Organizations of the Token's User it can Read the Billing of",
+	)
+	serverCmd.PersistentFlags().StringSliceVarP(
 		&serverArgs.User,
 		"user",
 		"u",
-		"",
-		"GitHub User Name",
+		nil,
+		"GitHub User Names",
+	)
+	serverCmd.PersistentFlags().StringSliceVar(
+		&serverArgs.Enterprises,
+		"enterprises",
+		nil,
+		"GitHub Enterprise Slugs",
+	)
+	serverCmd.PersistentFlags().StringToStringVar(
+		&serverArgs.OwnerLabelOverride,
+		"owner-label-override",
+		nil,
+		"Owner Label Values to Export instead of the Slugs, e.g. acme-platform-internal=Platform Team",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.BaseURL,
+		"base-url",
+		"https://api.github.com",
+		"GitHub API Base URL, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server",
 	)
 	serverCmd.PersistentFlags().StringVarP(
 		&serverArgs.Token,
@@ -64,18 +180,310 @@ func serverCmd() *cobra.Command {
 		"",
 		"GitHub Token",
 	)
+	serverCmd.PersistentFlags().StringToStringVar(
+		&serverArgs.OwnerTokens,
+		"owner-tokens",
+		nil,
+		"Tokens of Owners to Use instead of the GitHub Token, or @ and a File to Read the Token from, e.g. acme=@/run/secrets/acme-token",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.AuthScheme,
+		"auth-scheme",
+		"",
+		"Authorization Header Scheme(token or Bearer), detected from the token if empty",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.AcceptHeader,
+		"accept-header",
+		"application/vnd.github+json",
+		"Accept Header sent to the GitHub API",
+	)
+	serverCmd.PersistentFlags().StringToStringVar(
+		&serverArgs.ExtraHeaders,
+		"extra-headers",
+		nil,
+		"Extra Headers sent with every GitHub API Request, e.g. X-Internal-Auth=secret",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.GraphQLEnterprise,
+		"graphql-enterprise",
+		"",
+		"GitHub Enterprise Slug to Query License Billing via GraphQL",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.CostCenterEnterprise,
+		"cost-center-enterprise",
+		"",
+		"GitHub Enterprise Slug to Collect Cost Center Spend for, requires the Enhanced Billing Platform",
+	)
+	serverCmd.PersistentFlags().StringSliceVar(
+		&serverArgs.Repositories,
+		"repositories",
+		nil,
+		"GitHub Repositories(owner/name) to Collect Actions Cache Usage for",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.MaxRepoSeries,
+		"max-repo-series",
+		0,
+		"Maximum Number of Repositories to Collect Per-Repository Metrics for, 0 for no Limit",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EnablePprof,
+		"enable-pprof",
+		false,
+		"Enable /debug/pprof Endpoints",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EnableRefresh,
+		"enable-refresh",
+		false,
+		"Serve POST /refresh to Refresh all or one Owner out of Band",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.RefreshBasicAuth,
+		"refresh-basic-auth",
+		"",
+		"user:password Required by /refresh with Basic Auth",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.NativeHistograms,
+		"native-histograms",
+		false,
+		"Expose the Scrape Duration as a Native Histogram",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.DumpDir,
+		"dump-dir",
+		"",
+		"Directory to Write the Last Raw GitHub API Responses to",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.CSVOutput,
+		"csv-output",
+		"",
+		"CSV File to Append the Billing Values of Every Cycle to, Rotated Daily",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.TextfileOutput,
+		"textfile-output",
+		"",
+		"File to Write the Metrics to after Every Cycle for the node_exporter Textfile Collector",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.OTLPEndpoint,
+		"otlp-endpoint",
+		"",
+		"OTLP/HTTP Endpoint to Push the Metrics to every Refresh Interval, e.g. http://otel-collector:4318",
+	)
+	serverCmd.PersistentFlags().Float64Var(
+		&serverArgs.PricePerMinuteUbuntu,
+		"price-per-minute-ubuntu",
+		0.008,
+		"Ubuntu Runner Price Per Minute in USD",
+	)
+	serverCmd.PersistentFlags().Float64Var(
+		&serverArgs.PricePerMinuteMacos,
+		"price-per-minute-macos",
+		0.08,
+		"macOS Runner Price Per Minute in USD",
+	)
+	serverCmd.PersistentFlags().Float64Var(
+		&serverArgs.PricePerMinuteWindows,
+		"price-per-minute-windows",
+		0.016,
+		"Windows Runner Price Per Minute in USD",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.DecimalSeparator,
+		"decimal-separator",
+		"",
+		"Decimal Separator(. or ,) of Localized Paid Minutes, parsed strictly if empty",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.MinMinutesThreshold,
+		"min-minutes-threshold",
+		0,
+		"Total Minutes Used below which the Actions Billing of an Owner isn't Exported",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.UnlimitedIncludedMinutes,
+		"unlimited-included-minutes",
+		1000000,
+		"Included Minutes from which a Plan is Considered Unlimited, 0 to Only Detect Missing Included Minutes",
+	)
+	serverCmd.PersistentFlags().DurationVar(
+		&serverArgs.RolloverGracePeriod,
+		"rollover-grace-period",
+		0,
+		"How Long the Billing Values are Held after a Billing Cycle Rollover, 0 to Disable",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.MaxIdleConnsPerHost,
+		"max-idle-conns-per-host",
+		10,
+		"Maximum Idle Connections Kept Per Host",
+	)
+	serverCmd.PersistentFlags().DurationVar(
+		&serverArgs.IdleConnTimeout,
+		"idle-conn-timeout",
+		90*time.Second,
+		"Idle Connection Timeout",
+	)
+	serverCmd.PersistentFlags().DurationVar(
+		&serverArgs.KeepAlive,
+		"keep-alive",
+		30*time.Second,
+		"TCP Keep-Alive Period",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.DisableHTTP2,
+		"disable-http2",
+		false,
+		"Use HTTP/1.1 instead of HTTP/2 to the GitHub API",
+	)
+	serverCmd.PersistentFlags().Int64Var(
+		&serverArgs.MaxResponseBytes,
+		"max-response-bytes",
+		10<<20,
+		"Maximum Size of a GitHub API Response Body in Bytes",
+	)
+	serverCmd.PersistentFlags().DurationVar(
+		&serverArgs.BodyReadTimeout,
+		"body-read-timeout",
+		30*time.Second,
+		"Timeout of Reading a GitHub API Response Body, 0 for the Scrape Timeout only",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.MaxConcurrency,
+		"max-concurrency",
+		10,
+		"Maximum Number of GitHub API Requests in Flight",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EnableHedging,
+		"enable-hedging",
+		false,
+		"Send a Second Request for a GitHub API Request not Answered within Hedge After",
+	)
+	serverCmd.PersistentFlags().Float64Var(
+		&serverArgs.HedgeAfter,
+		"hedge-after",
+		0.5,
+		"Fraction of the Scrape Timeout after which a Request is Hedged",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EmitRollups,
+		"emit-rollups",
+		false,
+		"Emit Rollup Metrics Summed Across All Owners",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EmitRawFields,
+		"emit-raw-fields",
+		false,
+		"Emit Unknown Numeric Fields of the Actions Billing as github_actions_billing_raw",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EmitMinutesByKind,
+		"emit-minutes-by-kind",
+		false,
+		"Also Emit the Included, Used and Paid Actions Minutes as actions_minutes with a kind Label",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EmitGitHubTimestamps,
+		"emit-github-timestamps",
+		false,
+		"Timestamp Billing Samples with the Date Header of their GitHub Response instead of the Scrape Time",
+	)
+	serverCmd.PersistentFlags().IntVar(
+		&serverArgs.UsageHistoryMonths,
+		"usage-history-months",
+		0,
+		"Previous Months of the Enhanced Billing Usage Report to Export next to the Current One",
+	)
+	serverCmd.PersistentFlags().StringVar(
+		&serverArgs.UsageFormat,
+		"usage-format",
+		"json",
+		"Format to Request the Enhanced Billing Usage Report in(json or csv)",
+	)
+	// Decoded into serverArgs.Collectors by viper, pflag has no map of bools.
+	serverCmd.PersistentFlags().StringToString(
+		"collectors",
+		nil,
+		"Collectors to Enable or Disable, e.g. packages=false,cache=true",
+	)
+	serverCmd.PersistentFlags().StringSliceVar(
+		&serverArgs.EnabledMetrics,
+		"enabled-metrics",
+		nil,
+		"Billing Metric Names to Export, all if empty",
+	)
+	serverCmd.PersistentFlags().BoolVar(
+		&serverArgs.EmitLegacyMetricNames,
+		"emit-legacy-metric-names",
+		true,
+		"Also Export the Renamed Billing Metrics under their Former Names",
+	)
 
 	if err := viper.BindPFlags(serverCmd.PersistentFlags()); err != nil {
 		log.Fatalf("Failed to bind flags: %v\n", err)
 	}
 
 	cobra.OnInitialize(func() {
+		viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 		viper.AutomaticEnv()
 
-		if err := viper.Unmarshal(&serverArgs); err != nil {
+		if config := viper.GetString("config"); config != "" {
+			viper.SetConfigFile(config)
+			if err := viper.ReadInConfig(); err != nil {
+				log.Fatalf("Failed to read config file: %v\n", err)
+			}
+		}
+
+		hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			stringToMapHook,
+		))
+		if err := viper.Unmarshal(&serverArgs, hook); err != nil {
 			log.Fatalf("Failed to unmarshal arguments: %v\n", err)
 		}
+
+		// AutomaticEnv maps the user key to $USER, the login name of every
+		// shell, which would turn organization mode into user mode. The user
+		// names are read from $GITHUB_USER instead.
+		if !serverCmd.PersistentFlags().Changed("user") && !viper.InConfig("user") {
+			serverArgs.User = nil
+			if users := os.Getenv("GITHUB_USER"); users != "" {
+				serverArgs.User = strings.Split(users, ",")
+			}
+		}
 	})
 
 	return serverCmd
 }
+
+// stringToMapHook decodes maps set through environment variables, which
+// viper passes on as "key1=value1,key2=value2" strings. Values are converted
+// to the map's value type afterwards, e.g. to bool.
+func stringToMapHook(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+		return data, nil
+	}
+
+	m := make(map[string]string)
+	for _, pair := range strings.Split(data.(string), ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, xerrors.Errorf("invalid key=value pair %q", pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,191 @@
+// Package mockgithub serves canned GitHub billing responses, so the exporter
+// can be pointed at it with --base-url in integration tests.
+package mockgithub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Owner holds the billing responses of an organization, user or enterprise.
+// A nil response is served as 404 Not Found.
+type Owner struct {
+	Actions       interface{}
+	Packages      interface{}
+	SharedStorage interface{}
+	// Organization is served at /orgs/{org} and Copilot at
+	// /orgs/{org}/copilot/billing, both only for organizations.
+	Organization interface{}
+	Copilot      interface{}
+	// RateLimited answers every request with an exhausted rate limit.
+	RateLimited bool
+}
+
+// Server is an httptest.Server serving the billing endpoints of its owners,
+// e.g. /orgs/acme/settings/billing/actions.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	owners map[string]*Owner
+}
+
+// New starts a Server for the owners keyed by their slug. Close it when done.
+func New(owners map[string]*Owner) *Server {
+	s := &Server{owners: make(map[string]*Owner)}
+	for name, o := range owners {
+		s.owners[name] = o
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// SetOwner adds or replaces the responses of an owner.
+func (s *Server) SetOwner(name string, o *Owner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.owners[name] = o
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	// {orgs,users,enterprises}/{name}/settings/billing/{resource},
+	// orgs/{name} and orgs/{name}/copilot/billing
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	org := parts[0] == "orgs" && (len(parts) == 2 || len(parts) == 4 && parts[2] == "copilot" && parts[3] == "billing")
+	if !org && (len(parts) != 5 || parts[2] != "settings" || parts[3] != "billing") {
+		http.NotFound(w, req)
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.owners[parts[1]]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Reset", reset)
+	if o.RateLimited {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+		return
+	}
+	w.Header().Set("X-RateLimit-Remaining", "4999")
+
+	var body interface{}
+	switch {
+	case len(parts) == 2:
+		body = o.Organization
+	case len(parts) == 4:
+		body = o.Copilot
+	case parts[4] == "actions":
+		body = o.Actions
+	case parts[4] == "packages":
+		body = o.Packages
+	case parts[4] == "shared-storage":
+		body = o.SharedStorage
+	}
+	if body == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// OrgWithOverage is an organization which used more than its included
+// Actions minutes and Packages bandwidth.
+func OrgWithOverage() *Owner {
+	return &Owner{
+		Actions: map[string]interface{}{
+			"total_minutes_used":      3500,
+			"total_paid_minutes_used": "500.0",
+			"included_minutes":        3000,
+			"minutes_used_breakdown": map[string]int{
+				"UBUNTU":  2500,
+				"MACOS":   200,
+				"WINDOWS": 800,
+			},
+		},
+		Packages: map[string]interface{}{
+			"total_gigabytes_bandwidth_used":      60,
+			"total_paid_gigabytes_bandwidth_used": 10,
+			"included_gigabytes_bandwidth":        50,
+		},
+		SharedStorage: map[string]interface{}{
+			"days_left_in_billing_cycle":       10,
+			"estimated_paid_storage_for_month": 5,
+			"estimated_storage_for_month":      55,
+		},
+		Organization: map[string]interface{}{
+			"login":         "acme",
+			"billing_email": "billing@acme.example",
+		},
+		Copilot: map[string]interface{}{
+			"seat_breakdown": map[string]int{"total": 12},
+			"plan_type":      "business",
+		},
+	}
+}
+
+// OrgWithoutPackages is an organization within the free allowance whose
+// Packages billing returns 404. It has no Copilot subscription and its
+// billing email is only returned to owners.
+func OrgWithoutPackages() *Owner {
+	return &Owner{
+		Actions: map[string]interface{}{
+			"total_minutes_used":      120,
+			"total_paid_minutes_used": "0.0",
+			"included_minutes":        2000,
+			"minutes_used_breakdown": map[string]int{
+				"UBUNTU": 120,
+			},
+		},
+		SharedStorage: map[string]interface{}{
+			"days_left_in_billing_cycle":       20,
+			"estimated_paid_storage_for_month": 0,
+			"estimated_storage_for_month":      1,
+		},
+		Organization: map[string]interface{}{
+			"login": "beta",
+		},
+	}
+}
+
+// UserWithoutPackages is a user within the free allowance whose Packages
+// billing returns 404.
+func UserWithoutPackages() *Owner {
+	return &Owner{
+		Actions: map[string]interface{}{
+			"total_minutes_used":      120,
+			"total_paid_minutes_used": "0.0",
+			"included_minutes":        2000,
+			"minutes_used_breakdown": map[string]int{
+				"UBUNTU": 120,
+			},
+		},
+		SharedStorage: map[string]interface{}{
+			"days_left_in_billing_cycle":       20,
+			"estimated_paid_storage_for_month": 0,
+			"estimated_storage_for_month":      1,
+		},
+	}
+}
+
+// RateLimited is an owner whose requests all fail with an exhausted rate
+// limit.
+func RateLimited() *Owner {
+	return &Owner{RateLimited: true}
+}
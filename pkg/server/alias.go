@@ -0,0 +1,92 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// legacyMetricNames maps the billing metrics which were renamed with their
+// product prefix to the names they were exported under before.
+var legacyMetricNames = map[string]string{
+	"actions_total_minutes_used":                      "total_minutes_used",
+	"actions_total_paid_minutes_used":                 "total_paid_minutes_used",
+	"actions_included_minutes":                        "included_minutes",
+	"actions_minutes_used_breakdown":                  "minutes_used_breakdown",
+	"packages_total_gigabytes_bandwidth_used":         "total_gigabytes_bandwidth_used",
+	"packages_total_paid_gigabytes_bandwidth_used":    "total_paid_gigabytes_bandwidth_used",
+	"packages_included_gigabytes_bandwidth":           "included_gigabytes_bandwidth",
+	"shared_storage_days_left_in_billing_cycle":       "days_left_in_billing_cycle",
+	"shared_storage_estimated_paid_storage_for_month": "estimated_paid_storage_for_month",
+	"shared_storage_estimated_storage_for_month":      "estimated_storage_for_month",
+}
+
+// aliasCollector re-exports the gauges of a collector under a legacy name. It
+// is unchecked, as the label names are only known from the collected metrics.
+type aliasCollector struct {
+	name      string
+	help      string
+	collector prometheus.Collector
+}
+
+func newAliasCollector(name, current string, c prometheus.Collector) *aliasCollector {
+	return &aliasCollector{
+		name:      name,
+		help:      "deprecated, use " + current,
+		collector: c,
+	}
+}
+
+var registeredAliases struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+// registerAlias registers the aliasCollector of a legacy name once. Being
+// unchecked, the registry can't tell it is already registered, a second one
+// would fail every Gather with duplicate metrics.
+func registerAlias(legacy, current string, c prometheus.Collector) error {
+	registeredAliases.Lock()
+	defer registeredAliases.Unlock()
+
+	if registeredAliases.names[legacy] {
+		return nil
+	}
+	if _, err := register(newAliasCollector(legacy, current, c)); err != nil {
+		return err
+	}
+	if registeredAliases.names == nil {
+		registeredAliases.names = make(map[string]bool)
+	}
+	registeredAliases.names[legacy] = true
+
+	return nil
+}
+
+func (a *aliasCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (a *aliasCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		a.collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil || pb.Gauge == nil {
+			continue
+		}
+
+		labelNames := make([]string, 0, len(pb.Label))
+		labelValues := make([]string, 0, len(pb.Label))
+		for _, l := range pb.Label {
+			labelNames = append(labelNames, l.GetName())
+			labelValues = append(labelValues, l.GetValue())
+		}
+
+		desc := prometheus.NewDesc(a.name, a.help, labelNames, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, pb.Gauge.GetValue(), labelValues...)
+	}
+}
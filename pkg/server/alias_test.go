@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterMetricsTwiceWithLegacyNames(t *testing.T) {
+	args := &Args{EmitLegacyMetricNames: true}
+	for i := 0; i < 2; i++ {
+		if _, err := registerMetrics(args); err != nil {
+			t.Fatalf("registerMetrics #%d: %v", i+1, err)
+		}
+	}
+
+	totalMinutesUsedGauge.Reset()
+	totalMinutesUsedGauge.WithLabelValues("acme").Set(42)
+	defer totalMinutesUsedGauge.Reset()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var aliases int
+	for _, mf := range families {
+		if mf.GetName() != "total_minutes_used" {
+			continue
+		}
+		aliases++
+		if got := len(mf.GetMetric()); got != 1 {
+			t.Fatalf("total_minutes_used has %d metrics, want 1", got)
+		}
+		if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 42 {
+			t.Errorf("total_minutes_used = %v, want 42", got)
+		}
+	}
+	if aliases != 1 {
+		t.Errorf("total_minutes_used gathered %d times, want 1", aliases)
+	}
+}
@@ -1,9 +1,305 @@
 package server
 
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+)
+
 type Args struct {
-	Port         int
-	Refresh      int
-	Organization string
-	User         string
-	Token        string
+	Port                    int
+	AdminListenAddress      string `mapstructure:"admin-listen-address"`
+	ReadyOnRateLimit        bool   `mapstructure:"ready-on-rate-limit"`
+	ReadyRateLimitThreshold int    `mapstructure:"ready-rate-limit-threshold"`
+	Debug                   bool
+	LogScrapeResults        bool `mapstructure:"log-scrape-results"`
+	Refresh                 int
+	RefreshJitter           float64 `mapstructure:"refresh-jitter"`
+	Schedule                string
+	ScrapeTimeout           time.Duration            `mapstructure:"scrape-timeout"`
+	OwnerScrapeTimeouts     map[string]time.Duration `mapstructure:"owner-scrape-timeouts"`
+	Retries                 int
+	RetryableStatusCodes    []int `mapstructure:"retryable-status-codes"`
+	Organization            []string
+	AutoDiscoverOrgs        bool `mapstructure:"auto-discover-orgs"`
+	User                    []string
+	Enterprises             []string          `mapstructure:"enterprises"`
+	OwnerLabelOverride      map[string]string `mapstructure:"owner-label-override"`
+	BaseURL                 string            `mapstructure:"base-url"`
+	Token                   string
+	OwnerTokens             map[string]string `mapstructure:"owner-tokens"`
+	AuthScheme              string            `mapstructure:"auth-scheme"`
+	AcceptHeader            string            `mapstructure:"accept-header"`
+	ExtraHeaders            map[string]string `mapstructure:"extra-headers"`
+
+	GraphQLEnterprise    string   `mapstructure:"graphql-enterprise"`
+	CostCenterEnterprise string   `mapstructure:"cost-center-enterprise"`
+	Repositories         []string `mapstructure:"repositories"`
+	MaxRepoSeries        int      `mapstructure:"max-repo-series"`
+
+	EnablePprof      bool   `mapstructure:"enable-pprof"`
+	EnableRefresh    bool   `mapstructure:"enable-refresh"`
+	RefreshBasicAuth string `mapstructure:"refresh-basic-auth"`
+	NativeHistograms bool   `mapstructure:"native-histograms"`
+	DumpDir          string `mapstructure:"dump-dir"`
+	CSVOutput        string `mapstructure:"csv-output"`
+	TextfileOutput   string `mapstructure:"textfile-output"`
+	OTLPEndpoint     string `mapstructure:"otlp-endpoint"`
+
+	PricePerMinuteUbuntu     float64       `mapstructure:"price-per-minute-ubuntu"`
+	PricePerMinuteMacos      float64       `mapstructure:"price-per-minute-macos"`
+	PricePerMinuteWindows    float64       `mapstructure:"price-per-minute-windows"`
+	DecimalSeparator         string        `mapstructure:"decimal-separator"`
+	MinMinutesThreshold      int           `mapstructure:"min-minutes-threshold"`
+	UnlimitedIncludedMinutes int           `mapstructure:"unlimited-included-minutes"`
+	RolloverGracePeriod      time.Duration `mapstructure:"rollover-grace-period"`
+
+	MaxIdleConnsPerHost int           `mapstructure:"max-idle-conns-per-host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle-conn-timeout"`
+	KeepAlive           time.Duration `mapstructure:"keep-alive"`
+	DisableHTTP2        bool          `mapstructure:"disable-http2"`
+	MaxResponseBytes    int64         `mapstructure:"max-response-bytes"`
+	BodyReadTimeout     time.Duration `mapstructure:"body-read-timeout"`
+	MaxConcurrency      int           `mapstructure:"max-concurrency"`
+	EnableHedging       bool          `mapstructure:"enable-hedging"`
+	HedgeAfter          float64       `mapstructure:"hedge-after"`
+	// WrapTransport, if set, wraps the transport of the GitHub API client,
+	// e.g. for tracing or recording requests. It can't be set by a flag.
+	WrapTransport func(http.RoundTripper) http.RoundTripper `mapstructure:"-"`
+
+	Collectors            map[string]bool `mapstructure:"collectors"`
+	EmitRollups           bool            `mapstructure:"emit-rollups"`
+	EmitRawFields         bool            `mapstructure:"emit-raw-fields"`
+	EmitMinutesByKind     bool            `mapstructure:"emit-minutes-by-kind"`
+	EmitGitHubTimestamps  bool            `mapstructure:"emit-github-timestamps"`
+	UsageHistoryMonths    int             `mapstructure:"usage-history-months"`
+	UsageFormat           string          `mapstructure:"usage-format"`
+	EnabledMetrics        []string        `mapstructure:"enabled-metrics"`
+	EmitLegacyMetricNames bool            `mapstructure:"emit-legacy-metric-names"`
+}
+
+// owners lists the configured accounts once each, an owner listed twice,
+// e.g. -o acme,Acme, would otherwise be polled twice.
+func (args *Args) owners() []account {
+	var owners []account
+	seen := make(map[account]bool)
+	add := func(mode apiMode, name string) {
+		key := account{mode: mode, name: strings.ToLower(name)}
+		if !seen[key] {
+			seen[key] = true
+			owners = append(owners, account{mode: mode, name: name})
+		}
+	}
+
+	if len(args.Organization) > 0 {
+		for _, name := range args.Organization {
+			add(orgMode, name)
+		}
+	} else {
+		for _, name := range args.User {
+			add(userMode, name)
+		}
+	}
+	for _, name := range args.Enterprises {
+		add(enterpriseMode, name)
+	}
+
+	return owners
+}
+
+// ownerLabel is the owner label value of an organization, user or enterprise
+// slug, which is still used in the API paths.
+func (args *Args) ownerLabel(slug string) string {
+	if name, ok := args.OwnerLabelOverride[slug]; ok {
+		return name
+	}
+
+	return slug
+}
+
+// label is the owner label of an account. An override can be qualified by
+// the owner type, e.g. enterprise:acme=acme-enterprise, to tell apart an
+// enterprise and an organization sharing a slug.
+func (args *Args) label(o account) string {
+	if name, ok := args.OwnerLabelOverride[o.mode.String()+":"+o.name]; ok {
+		return name
+	}
+
+	return args.ownerLabel(o.name)
+}
+
+// checkOwnerLabels rejects owners sharing an owner label, e.g. an enterprise
+// and one of its organizations with the same slug, whose metrics would
+// overwrite each other.
+func (args *Args) checkOwnerLabels() error {
+	seen := make(map[string]account)
+	for _, o := range args.owners() {
+		label := args.label(o)
+		if other, ok := seen[label]; ok {
+			return xerrors.Errorf("the %s %s and the %s %s share the owner label %q: tell them apart with --owner-label-override, e.g. %s:%s=%s-%s",
+				other.mode, other.name, o.mode, o.name, label, o.mode, o.name, o.name, o.mode)
+		}
+		seen[label] = o
+	}
+
+	return nil
+}
+
+// optionalCollectors are off unless enabled in args.Collectors, their
+// endpoints need scopes or a billing platform most tokens or owners lack.
+var optionalCollectors = map[string]bool{
+	"budgets": true,
+	"copilot": true,
+}
+
+// collectorEnabled reports whether the collector of an endpoint is enabled,
+// all but the optionalCollectors are unless disabled in args.Collectors. The
+// ones needing what to collect run only once given it, e.g.
+// args.Repositories for cache.
+func (args *Args) collectorEnabled(endpoint string) bool {
+	enabled, ok := args.Collectors[endpoint]
+	if !ok {
+		return !optionalCollectors[endpoint]
+	}
+	return enabled
+}
+
+// scrapeTimeout is the timeout of the cycles of an owner label, e.g. longer
+// for a slow GitHub Enterprise Server enterprise.
+func (args *Args) scrapeTimeout(owner string) time.Duration {
+	if timeout, ok := args.OwnerScrapeTimeouts[owner]; ok {
+		return timeout
+	}
+
+	return args.ScrapeTimeout
+}
+
+// token is the token of the requests of an owner label, args.Token unless
+// the owner has its own in args.OwnerTokens.
+func (args *Args) token(owner string) string {
+	if token, ok := args.OwnerTokens[owner]; ok {
+		return token
+	}
+
+	return args.Token
+}
+
+// readOwnerTokenFiles replaces the owner tokens given as @path, e.g.
+// @/run/secrets/acme-token, with the content of their file.
+func (args *Args) readOwnerTokenFiles() error {
+	for owner, token := range args.OwnerTokens {
+		if !strings.HasPrefix(token, "@") {
+			continue
+		}
+		b, err := ioutil.ReadFile(token[1:])
+		if err != nil {
+			return xerrors.Errorf("reading token of %s: %w", owner, err)
+		}
+		args.OwnerTokens[owner] = strings.TrimSpace(string(b))
+	}
+
+	return nil
+}
+
+// Validate checks the configuration without making any request.
+func (args *Args) Validate() error {
+	if (len(args.Organization) > 0 || args.AutoDiscoverOrgs) && len(args.User) > 0 {
+		return xerrors.New("organization and user are mutually exclusive")
+	}
+	if len(args.owners()) == 0 && !args.AutoDiscoverOrgs && len(args.Repositories) == 0 &&
+		args.CostCenterEnterprise == "" && args.GraphQLEnterprise == "" {
+		return xerrors.New("nothing to collect: set an organization, user, enterprise, repository, cost center enterprise or GraphQL enterprise")
+	}
+	if args.Token == "" {
+		return xerrors.New("token is required")
+	}
+
+	baseURL, err := url.Parse(args.BaseURL)
+	if err != nil {
+		return xerrors.Errorf("invalid base URL %q: %w", args.BaseURL, err)
+	}
+	if (baseURL.Scheme != "https" && baseURL.Scheme != "http") || baseURL.Host == "" {
+		return xerrors.Errorf("invalid base URL %q: must be an absolute http(s) URL", args.BaseURL)
+	}
+
+	if args.ScrapeTimeout <= 0 {
+		return xerrors.Errorf("invalid scrape timeout %v: must be positive", args.ScrapeTimeout)
+	}
+	for owner, timeout := range args.OwnerScrapeTimeouts {
+		if timeout <= 0 {
+			return xerrors.Errorf("invalid scrape timeout %v of %s: must be positive", timeout, owner)
+		}
+	}
+	if args.RefreshJitter < 0 || args.RefreshJitter >= 1 {
+		return xerrors.Errorf("invalid refresh jitter %v: must be at least 0 and less than 1", args.RefreshJitter)
+	}
+	if args.MaxResponseBytes <= 0 {
+		return xerrors.Errorf("invalid max response bytes %d: must be positive", args.MaxResponseBytes)
+	}
+	if args.DecimalSeparator != "" && args.DecimalSeparator != "." && args.DecimalSeparator != "," {
+		return xerrors.Errorf("invalid decimal separator %q: must be . or ,", args.DecimalSeparator)
+	}
+	if args.Schedule != "" {
+		if _, err := cron.ParseStandard(args.Schedule); err != nil {
+			return xerrors.Errorf("invalid schedule %q: %w", args.Schedule, err)
+		}
+	}
+	if args.TextfileOutput != "" && filepath.Ext(args.TextfileOutput) != ".prom" {
+		return xerrors.Errorf("invalid textfile output %s: the textfile collector only reads .prom files", args.TextfileOutput)
+	}
+	if args.BodyReadTimeout < 0 {
+		return xerrors.Errorf("invalid body read timeout %v: must not be negative", args.BodyReadTimeout)
+	}
+	if args.OTLPEndpoint != "" {
+		otlpURL, err := url.Parse(args.OTLPEndpoint)
+		if err != nil || (otlpURL.Scheme != "https" && otlpURL.Scheme != "http") || otlpURL.Host == "" {
+			return xerrors.Errorf("invalid OTLP endpoint %q: must be an absolute http(s) URL", args.OTLPEndpoint)
+		}
+	}
+	if args.UsageHistoryMonths < 0 || args.UsageHistoryMonths > maxUsageHistoryMonths {
+		return xerrors.Errorf("invalid usage history months %d: must be between 0 and %d", args.UsageHistoryMonths, maxUsageHistoryMonths)
+	}
+	if args.RolloverGracePeriod < 0 {
+		return xerrors.Errorf("invalid rollover grace period %v: must not be negative", args.RolloverGracePeriod)
+	}
+	if args.UnlimitedIncludedMinutes < 0 {
+		return xerrors.Errorf("invalid unlimited included minutes %d: must not be negative", args.UnlimitedIncludedMinutes)
+	}
+	if args.RefreshBasicAuth != "" && !strings.Contains(args.RefreshBasicAuth, ":") {
+		return xerrors.New("invalid refresh basic auth: must be user:password")
+	}
+	if args.MinMinutesThreshold < 0 {
+		return xerrors.Errorf("invalid min minutes threshold %d: must not be negative", args.MinMinutesThreshold)
+	}
+	if args.MaxRepoSeries < 0 {
+		return xerrors.Errorf("invalid max repo series %d: must not be negative", args.MaxRepoSeries)
+	}
+	if args.EnableHedging && (args.HedgeAfter <= 0 || args.HedgeAfter >= 1) {
+		return xerrors.Errorf("invalid hedge after %v: must be more than 0 and less than 1", args.HedgeAfter)
+	}
+	if args.UsageFormat != "" && args.UsageFormat != "json" && args.UsageFormat != "csv" {
+		return xerrors.Errorf("invalid usage format %q: must be json or csv", args.UsageFormat)
+	}
+	if args.MaxConcurrency <= 0 {
+		return xerrors.Errorf("invalid max concurrency %d: must be positive", args.MaxConcurrency)
+	}
+	for name := range args.Collectors {
+		if !knownEndpoints()[name] {
+			return xerrors.Errorf("unknown collector %q", name)
+		}
+	}
+	if err := args.checkOwnerLabels(); err != nil {
+		return err
+	}
+	if _, err := enabledMetrics(args.EnabledMetrics); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,518 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/xerrors"
+)
+
+// errEmptyBody is returned for a 200 response without any billing data, which
+// GitHub occasionally sends for accounts without billing activity. It is not
+// the same as every value being 0, so the gauges are left untouched.
+var errEmptyBody = xerrors.New("empty response body")
+
+func newHTTPClient(args *Args) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: args.KeepAlive,
+	}).DialContext
+	transport.MaxIdleConnsPerHost = args.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = args.IdleConnTimeout
+	// The transport asks for gzip and decompresses it as long as requests
+	// don't set Accept-Encoding themselves.
+	transport.DisableCompression = false
+	if args.DisableHTTP2 {
+		// A non-nil empty map keeps the transport from upgrading TLS
+		// connections to HTTP/2.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	var rt http.RoundTripper = transport
+	if args.WrapTransport != nil {
+		rt = args.WrapTransport(rt)
+	}
+
+	return &http.Client{Transport: rt, CheckRedirect: checkRedirect}
+}
+
+// checkRedirect follows redirects within the host of the original request,
+// e.g. of a GitHub Enterprise Server installed under a path, keeping its
+// Authorization header. Redirects to other hosts are refused rather than
+// followed without the token or leaking it.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return xerrors.Errorf("stopped after %d redirects", len(via))
+	}
+
+	orig := via[0]
+	if req.URL.Host != orig.URL.Host {
+		logf(req.Context(), "WARNING: refused redirect of %s to another host %s\n", orig.URL, req.URL.Host)
+		return xerrors.Errorf("refused redirect to another host %s", req.URL.Host)
+	}
+	if auth := orig.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	return nil
+}
+
+func newGitHubRequest(ctx context.Context, method, url string, body io.Reader, args *Args) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", args.AcceptHeader)
+	owner, _ := ownerFromContext(ctx)
+	token := args.token(owner)
+	req.Header.Set("Authorization", fmt.Sprintf("%s %s", authScheme(args, token), token))
+	// Set last, so proxies in front of GitHub Enterprise Server requiring
+	// their own credentials or media types can be satisfied.
+	for name, value := range args.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// authScheme defaults to Bearer for fine-grained personal access tokens and
+// GitHub App installation tokens, and to the classic token scheme otherwise.
+func authScheme(args *Args, token string) string {
+	if args.AuthScheme != "" {
+		return args.AuthScheme
+	}
+
+	for _, prefix := range []string{"github_pat_", "ghs_", "ghu_"} {
+		if strings.HasPrefix(token, prefix) {
+			return "Bearer"
+		}
+	}
+
+	return "token"
+}
+
+// isWorkflowToken reports whether the token looks like the GITHUB_TOKEN of a
+// GitHub Actions workflow, an installation token limited to the workflow's
+// repository, which can't read most billing endpoints.
+func isWorkflowToken(args *Args) bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true" && strings.HasPrefix(args.Token, "ghs_")
+}
+
+// unavailableToWorkflowToken reports whether err is a workflow token being
+// denied access, as opposed to it running out of its rate limit.
+func unavailableToWorkflowToken(err error, args *Args) bool {
+	var rateLimitedErr *rateLimitedError
+	return isWorkflowToken(args) && xerrors.Is(err, errForbidden) && !xerrors.As(err, &rateLimitedErr)
+}
+
+// fetch GETs an API path, e.g. /orgs/acme/settings/billing/actions, relative
+// to the configured base URL.
+func fetch(ctx context.Context, client *http.Client, path string, args *Args, v interface{}) error {
+	return fetchAs(ctx, client, path, args.AcceptHeader, args, v)
+}
+
+// fetchAs is fetch asking for another media type than args.AcceptHeader,
+// e.g. text/csv, v then implements bodyUnmarshaler.
+func fetchAs(ctx context.Context, client *http.Client, path, accept string, args *Args, v interface{}) error {
+	return retry(ctx, args, func() error {
+		req, err := newGitHubRequest(ctx, "GET", strings.TrimSuffix(args.BaseURL, "/")+path, nil, args)
+		if err != nil {
+			return err
+		}
+		if accept != args.AcceptHeader {
+			req.Header.Set("Accept", accept)
+		}
+
+		return do(client, req, args, v)
+	})
+}
+
+// retry repeats attempt up to args.Retries times while it fails with a
+// transient error, waiting one more second before every retry, or until the
+// rate limit allows another request.
+func retry(ctx context.Context, args *Args, attempt func() error) error {
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || i > args.Retries || !isRetryable(err, args) {
+			return err
+		}
+
+		wait := time.Duration(i) * time.Second
+		var rateLimitedErr *rateLimitedError
+		rateLimited := xerrors.As(err, &rateLimitedErr)
+		if rateLimited && rateLimitedErr.retryAfter > wait {
+			wait = rateLimitedErr.retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && rateLimited && time.Until(deadline) < wait {
+			// The limit resets after the cycle ends, the next one waits for it.
+			return err
+		}
+
+		debugf(ctx, "Retrying (%d/%d) in %v after %v\n", i, args.Retries, wait, err)
+		waitStart := time.Now()
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		if owner, ok := ownerFromContext(ctx); ok && rateLimited {
+			rateLimitWaitSecondsCounter.WithLabelValues(owner).Add(time.Since(waitStart).Seconds())
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// isRetryable reports whether err is likely to go away on a re-fetch, such
+// as a body truncated by a dropped connection, a rate limit or one of the
+// configured transient status codes.
+func isRetryable(err error, args *Args) bool {
+	if xerrors.Is(err, io.ErrUnexpectedEOF) || xerrors.Is(err, io.EOF) {
+		return true
+	}
+
+	// Primary rate limits are a 403, which isn't a transient status code.
+	var rateLimitedErr *rateLimitedError
+	if xerrors.As(err, &rateLimitedErr) {
+		return true
+	}
+
+	var statusErr *statusError
+	if xerrors.As(err, &statusErr) {
+		for _, code := range args.RetryableStatusCodes {
+			if statusErr.code == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	var syntaxErr *json.SyntaxError
+	return xerrors.As(err, &syntaxErr) && syntaxErr.Error() == "unexpected end of JSON input"
+}
+
+func do(client *http.Client, req *http.Request, args *Args, v interface{}) error {
+	release, err := acquireRequestSlot(req.Context())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var resp *http.Response
+	if delay, ok := hedgeDelay(req, args); ok {
+		resp, err = hedgedDo(client, req, delay)
+	} else {
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if owner, ok := ownerFromContext(req.Context()); ok {
+		recordTokenScopes(owner, resp.Header)
+		recordRateLimit(owner, resp.Header)
+	}
+	recordTimeSkew(req.Context(), resp.Header)
+
+	if resp.StatusCode != http.StatusOK {
+		return newStatusError(req, resp)
+	}
+
+	reader, err := decodedBody(resp)
+	if err != nil {
+		return xerrors.Errorf("%s %s: %w", req.Method, req.URL, err)
+	}
+
+	// The body is bound to the request context, so reading a slow or huge
+	// response stops once the scrape timeout is exceeded. The limit applies
+	// to the decompressed body. A body trickling in slower than the body
+	// read timeout is cut off by closing it.
+	var bodyTimedOut int32
+	if args.BodyReadTimeout > 0 {
+		timer := time.AfterFunc(args.BodyReadTimeout, func() {
+			atomic.StoreInt32(&bodyTimedOut, 1)
+			resp.Body.Close()
+		})
+		defer timer.Stop()
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(reader, args.MaxResponseBytes+1))
+	recordResponseBytes(req.Context(), len(body))
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return xerrors.Errorf("%s %s: reading response body aborted after %d bytes: %w", req.Method, req.URL, len(body), ctxErr)
+	}
+	if atomic.LoadInt32(&bodyTimedOut) == 1 {
+		return xerrors.Errorf("%s %s: reading response body timed out after %v and %d bytes", req.Method, req.URL, args.BodyReadTimeout, len(body))
+	}
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > args.MaxResponseBytes {
+		return xerrors.Errorf("%s %s: response body exceeds %d bytes", req.Method, req.URL, args.MaxResponseBytes)
+	}
+
+	if args.DumpDir != "" {
+		dumpResponse(args.DumpDir, req, body)
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || bytes.Equal(trimmed, []byte("{}")) {
+		return errEmptyBody
+	}
+
+	decodeStart := time.Now()
+	defer recordDecodeDuration(req.Context(), decodeStart)
+	if u, ok := v.(bodyUnmarshaler); ok {
+		return u.unmarshalBody(body)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// bodyUnmarshaler decodes response bodies which aren't JSON.
+type bodyUnmarshaler interface {
+	unmarshalBody(body []byte) error
+}
+
+// decodedBody decompresses a gzip body the transport left alone, e.g. one
+// served with Content-Encoding: gzip without being asked for by it.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+
+	return gzip.NewReader(resp.Body)
+}
+
+// redactedURL drops credentials embedded in a URL before it is exported.
+func redactedURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.User == nil {
+		return u
+	}
+	parsed.User = nil
+
+	return parsed.String()
+}
+
+type ownerContextKey struct{}
+
+// withOwner tags the requests of a collection cycle with the owner they are
+// made for, so per-response metrics can be labeled by it.
+func withOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerContextKey{}, owner)
+}
+
+type endpointContextKey struct{}
+
+// withEndpoint tags the requests of a collection cycle with the billing
+// endpoint they are made for.
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointContextKey{}, endpoint)
+}
+
+// ownerFromContext returns the owner a request is made for, if it belongs to
+// a collection cycle.
+func ownerFromContext(ctx context.Context) (string, bool) {
+	owner, ok := ctx.Value(ownerContextKey{}).(string)
+	return owner, ok
+}
+
+// endpointFromContext returns the billing endpoint a request is made for, if
+// it belongs to a collection cycle.
+func endpointFromContext(ctx context.Context) (string, bool) {
+	endpoint, ok := ctx.Value(endpointContextKey{}).(string)
+	return endpoint, ok
+}
+
+// recordResponseBytes counts the body bytes read for the owner and endpoint
+// of a cycle, after decompression.
+func recordResponseBytes(ctx context.Context, n int) {
+	owner, ok := ownerFromContext(ctx)
+	if !ok {
+		return
+	}
+	endpoint, ok := endpointFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	responseBytesCounter.WithLabelValues(owner, endpoint).Add(float64(n))
+}
+
+// recordDecodeDuration observes the time spent decoding a body since start,
+// telling a slow GitHub API from a pathologically large payload.
+func recordDecodeDuration(ctx context.Context, start time.Time) {
+	owner, ok := ownerFromContext(ctx)
+	if !ok {
+		return
+	}
+	endpoint, ok := endpointFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	decodeDurationHistogram.WithLabelValues(owner, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// recordTimeSkew compares the Date header with the local clock, it only has
+// a resolution of a second.
+func recordTimeSkew(ctx context.Context, h http.Header) {
+	owner, ok := ownerFromContext(ctx)
+	if !ok {
+		return
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	timeSkewGauge.WithLabelValues(owner).Set(time.Since(date).Seconds())
+	setResponseDate(owner, date)
+}
+
+// ssoAuthorizationURL parses the X-GitHub-SSO header, e.g.
+// "required; url=https://github.com/orgs/acme/sso?authorization_request=...".
+func ssoAuthorizationURL(h http.Header) string {
+	v := h.Get("X-GitHub-SSO")
+	if !strings.HasPrefix(v, "required") {
+		return ""
+	}
+
+	for _, part := range strings.Split(v, ";") {
+		if part = strings.TrimSpace(part); strings.HasPrefix(part, "url=") {
+			return strings.TrimPrefix(part, "url=")
+		}
+	}
+
+	return ""
+}
+
+var ssoWarned struct {
+	sync.Mutex
+	owners map[string]bool
+}
+
+// recordSSOAuthorization flags owners whose SSO enforcement rejected the
+// token, the authorization URL is only logged the first time.
+func recordSSOAuthorization(owner string, err error) {
+	var statusErr *statusError
+	if !xerrors.As(err, &statusErr) || statusErr.ssoURL == "" {
+		if err == nil {
+			ssoAuthorizationRequiredGauge.WithLabelValues(owner).Set(0)
+		}
+		return
+	}
+	ssoAuthorizationRequiredGauge.WithLabelValues(owner).Set(1)
+
+	ssoWarned.Lock()
+	defer ssoWarned.Unlock()
+
+	if ssoWarned.owners == nil {
+		ssoWarned.owners = make(map[string]bool)
+	}
+	if !ssoWarned.owners[owner] {
+		ssoWarned.owners[owner] = true
+		log.Printf("WARNING: %s enforces SAML single sign-on, authorize the token at %s\n", owner, statusErr.ssoURL)
+	}
+}
+
+// recordEndpointAccess tells readable endpoints from those the token is denied
+// or can't see. Other failures, e.g. timeouts, and empty responses say
+// nothing about access and leave the gauge untouched.
+func recordEndpointAccess(owner, endpoint string, err error) {
+	switch {
+	case err == nil:
+		endpointAccessibleGauge.WithLabelValues(owner, endpoint).Set(1)
+	case xerrors.Is(err, errForbidden) || xerrors.Is(err, errNotFound):
+		endpointAccessibleGauge.WithLabelValues(owner, endpoint).Set(0)
+	}
+}
+
+// tokenScopes holds the exported X-OAuth-Scopes per owner, each owner may
+// authenticate with its own token.
+var tokenScopes = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// recordTokenScopes exports the X-OAuth-Scopes header of an owner's token.
+// Fine-grained tokens and GitHub Apps don't send it, in which case nothing is
+// exported.
+func recordTokenScopes(owner string, h http.Header) {
+	values, ok := h[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	if !ok {
+		return
+	}
+
+	var scopes []string
+	for _, v := range values {
+		for _, scope := range strings.Split(v, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	value := strings.Join(scopes, ",")
+
+	tokenScopes.Lock()
+	defer tokenScopes.Unlock()
+
+	if recorded, ok := tokenScopes.m[owner]; ok && value == recorded {
+		return
+	}
+	tokenScopes.m[owner] = value
+
+	tokenScopesInfoGauge.DeletePartialMatch(prometheus.Labels{"owner": owner})
+	tokenScopesInfoGauge.WithLabelValues(owner, value).Set(1)
+}
+
+// dumpResponse overwrites the last response body of an endpoint, the file
+// name is derived from the request path and query, e.g.
+// orgs_acme_settings_billing_actions.json or
+// organizations_acme_settings_billing_usage_year-2026_month-9.json.
+func dumpResponse(dir string, req *http.Request, body []byte) {
+	name := strings.ReplaceAll(strings.Trim(req.URL.Path, "/"), "/", "_")
+	if req.URL.RawQuery != "" {
+		name += "_" + dumpQuery(req.URL.RawQuery)
+	}
+	name += ".json"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), body, 0600); err != nil {
+		logf(req.Context(), "Failed to dump response of %s %s: %v\n", req.Method, req.URL, err)
+	}
+}
+
+// dumpQuery turns a query into a file name part, e.g. year=2026&month=9 into
+// year-2026_month-9, replacing anything but letters, digits, dots and dashes.
+func dumpQuery(rawQuery string) string {
+	name := strings.NewReplacer("&", "_", "=", "-").Replace(rawQuery)
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, name)
+}
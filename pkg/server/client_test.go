@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestIsRetryable(t *testing.T) {
+	args := &Args{RetryableStatusCodes: []int{429, 500, 502, 503, 504}}
+	status := func(code int) *statusError {
+		return &statusError{method: "GET", url: "https://api.github.com/orgs/acme/settings/billing/actions", status: http.StatusText(code), code: code}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"truncated body", xerrors.Errorf("decode: %w", io.ErrUnexpectedEOF), true},
+		{"retryable status", status(http.StatusBadGateway), true},
+		{"forbidden", status(http.StatusForbidden), false},
+		{"not found", status(http.StatusNotFound), false},
+		{"primary rate limit", &rateLimitedError{statusError: status(http.StatusForbidden)}, true},
+		{"secondary rate limit", &rateLimitedError{statusError: status(http.StatusTooManyRequests)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err, args); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRetriesTruncatedBody(t *testing.T) {
+	const body = `{"total_minutes_used":305,"total_paid_minutes_used":"0","included_minutes":3000}`
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// The connection drops halfway through the body.
+			io.WriteString(w, body[:len(body)/2])
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	args := &Args{BaseURL: srv.URL, Token: "x", Retries: 2, MaxResponseBytes: 1 << 20}
+	var p actionsBilling
+	if err := fetch(context.Background(), srv.Client(), "/orgs/acme/settings/billing/actions", args, &p); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+	if p.TotalMinutesUsed != 305 {
+		t.Errorf("total_minutes_used = %d, want 305", p.TotalMinutesUsed)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	var reached int32
+	target := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reached, 1)
+		if got := req.Header.Get("Authorization"); got != "token x" {
+			t.Errorf("Authorization = %q after the redirect, want the token", got)
+		}
+		io.WriteString(w, "{}")
+	})
+	other := httptest.NewServer(target)
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/github/api/v3/orgs/acme/settings/billing/actions", target)
+	mux.HandleFunc("/api/v3/orgs/acme/settings/billing/actions", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/github"+req.URL.Path, http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved/orgs/acme/settings/billing/actions", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, other.URL+"/orgs/acme/settings/billing/actions", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantErr     bool
+		wantReached int32
+	}{
+		{"same host", "/api/v3/orgs/acme/settings/billing/actions", false, 1},
+		{"other host", "/moved/orgs/acme/settings/billing/actions", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&reached, 0)
+			req, err := newGitHubRequest(context.Background(), http.MethodGet, srv.URL+tt.path, nil, &Args{Token: "x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := &http.Client{CheckRedirect: checkRedirect}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&reached); got != tt.wantReached {
+				t.Errorf("redirect target reached %d times, want %d", got, tt.wantReached)
+			}
+		})
+	}
+}
+
+func TestDumpResponseKeepsQueries(t *testing.T) {
+	dir := t.TempDir()
+	for _, u := range []string{
+		"https://api.github.com/organizations/acme/settings/billing/usage?year=2026&month=10",
+		"https://api.github.com/organizations/acme/settings/billing/usage?year=2026&month=9",
+		"https://api.github.com/orgs/acme/settings/billing/actions",
+	} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumpResponse(dir, req, []byte(u))
+	}
+
+	for name, want := range map[string]string{
+		"organizations_acme_settings_billing_usage_year-2026_month-10.json": "https://api.github.com/organizations/acme/settings/billing/usage?year=2026&month=10",
+		"organizations_acme_settings_billing_usage_year-2026_month-9.json":  "https://api.github.com/organizations/acme/settings/billing/usage?year=2026&month=9",
+		"orgs_acme_settings_billing_actions.json":                           "https://api.github.com/orgs/acme/settings/billing/actions",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("dump %s: %v", name, err)
+			continue
+		}
+		if string(b) != want {
+			t.Errorf("dump %s = %q, want %q", name, b, want)
+		}
+	}
+}
+
+func TestDumpQuery(t *testing.T) {
+	tests := []struct {
+		rawQuery string
+		want     string
+	}{
+		{"year=2026&month=9", "year-2026_month-9"},
+		{"cost_center_id=a%2Fb", "cost_center_id-a-2Fb"},
+		{"q=../../etc", "q-..-..-etc"},
+	}
+	for _, tt := range tests {
+		if got := dumpQuery(tt.rawQuery); got != tt.want {
+			t.Errorf("dumpQuery(%q) = %q, want %q", tt.rawQuery, got, tt.want)
+		}
+	}
+}
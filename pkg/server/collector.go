@@ -2,14 +2,19 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/xerrors"
 )
 
 type apiMode int
@@ -17,55 +22,151 @@ type apiMode int
 const (
 	orgMode apiMode = iota + 1
 	userMode
+	enterpriseMode
 )
 
+func (m apiMode) String() string {
+	switch m {
+	case orgMode:
+		return "org"
+	case userMode:
+		return "user"
+	case enterpriseMode:
+		return "enterprise"
+	default:
+		return "unknown"
+	}
+}
+
+type account struct {
+	mode apiMode
+	name string
+}
+
 var (
 	totalMinutesUsedGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "total_minutes_used",
+			Name: "actions_total_minutes_used",
 			Help: "github actions total minutes used",
 		},
 		[]string{"owner"},
 	)
 	totalPaidMinutesUsedGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "total_paid_minutes_used",
+			Name: "actions_total_paid_minutes_used",
 			Help: "github actions total paid minutes used",
 		},
 		[]string{"owner"},
 	)
 	includedMinutesGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "included_minutes",
+			Name: "actions_included_minutes",
 			Help: "github actions included minutes",
 		},
 		[]string{"owner"},
 	)
 	minutesUsedBreakdownGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "minutes_used_breakdown",
+			Name: "actions_minutes_used_breakdown",
 			Help: "github actions minutes used breakdown",
 		},
 		[]string{"owner", "os"},
 	)
+	freeMinutesUsedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_free_minutes_used",
+			Help: "github actions free minutes used",
+		},
+		[]string{"owner"},
+	)
+	macosMinutesRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_macos_minutes_ratio",
+			Help: "github actions macos minutes as a fraction of total minutes used",
+		},
+		[]string{"owner"},
+	)
+	daysUntilExhaustionGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_days_until_exhaustion",
+			Help: "github actions estimated days until the included minutes are used up",
+		},
+		[]string{"owner"},
+	)
+	actionsPaidUsageActiveGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_paid_usage_active",
+			Help: "1 if github actions paid minutes were used this billing cycle",
+		},
+		[]string{"owner"},
+	)
+	actionsSelfHostedMinutesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_self_hosted_minutes",
+			Help: "github actions minutes used but missing from the breakdown, i.e. on self-hosted runners",
+		},
+		[]string{"owner"},
+	)
+	actionsPlanUnlimitedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_plan_unlimited",
+			Help: "1 if the github plan includes unlimited actions minutes",
+		},
+		[]string{"owner"},
+	)
+	actionsMinutesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_minutes",
+			Help: "github actions minutes by kind, included, used or paid",
+		},
+		[]string{"owner", "kind"},
+	)
+	actionsBillingRawGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_actions_billing_raw",
+			Help: "github actions billing numeric fields without a dedicated metric",
+		},
+		[]string{"owner", "field"},
+	)
+	estimatedCostGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_estimated_cost_usd",
+			Help: "github actions estimated cost in USD",
+		},
+		[]string{"owner"},
+	)
 
 	totalGigabytesBandwidthUsedGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "total_gigabytes_bandwidth_used",
+			Name: "packages_total_gigabytes_bandwidth_used",
 			Help: "github packages included minutes",
 		},
 		[]string{"owner"},
 	)
+	packagesPaidBandwidthRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "packages_paid_bandwidth_ratio",
+			Help: "github packages paid bandwidth as a fraction of included bandwidth",
+		},
+		[]string{"owner"},
+	)
+	packagesPaidUsageActiveGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "packages_paid_usage_active",
+			Help: "1 if github packages paid bandwidth was used this billing cycle",
+		},
+		[]string{"owner"},
+	)
 	totalPaidGigabytesBandwidthUsedGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "total_paid_gigabytes_bandwidth_used",
+			Name: "packages_total_paid_gigabytes_bandwidth_used",
 			Help: "github packages total paid gigabytes bandwidth used",
 		},
 		[]string{"owner"},
 	)
 	includedGigabytesBandwidthGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "included_gigabytes_bandwidth",
+			Name: "packages_included_gigabytes_bandwidth",
 			Help: "github packages included gigabytes bandwidth",
 		},
 		[]string{"owner"},
@@ -73,36 +174,385 @@ var (
 
 	daysLeftInBillingCycleGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "days_left_in_billing_cycle",
+			Name: "shared_storage_days_left_in_billing_cycle",
 			Help: "github shared storage days left in billing cycle",
 		},
 		[]string{"owner"},
 	)
+	sharedStorageFreeEstimateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shared_storage_free_estimate",
+			Help: "github shared storage estimated for month within the included quota",
+		},
+		[]string{"owner"},
+	)
+	billingCycleSecondsElapsedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "billing_cycle_seconds_elapsed",
+			Help: "estimated seconds since the github billing cycle started",
+		},
+		[]string{"owner"},
+	)
 	estimatedPaidStorageForMonthGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "estimated_paid_storage_for_month",
+			Name: "shared_storage_estimated_paid_storage_for_month",
 			Help: "github shared storage estimated paid storage for month",
 		},
 		[]string{"owner"},
 	)
 	estimatedStorageForMonthGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "estimated_storage_for_month",
+			Name: "shared_storage_estimated_storage_for_month",
 			Help: "github shared storage estimated storage for month",
 		},
 		[]string{"owner"},
 	)
+
+	enterpriseLicensesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "enterprise_licenses",
+			Help: "github enterprise total licenses",
+		},
+		[]string{"owner"},
+	)
+	enterpriseAvailableLicensesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "enterprise_available_licenses",
+			Help: "github enterprise available licenses",
+		},
+		[]string{"owner"},
+	)
+	enterpriseLicensableUsersGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "enterprise_licensable_users",
+			Help: "github enterprise licensable users",
+		},
+		[]string{"owner"},
+	)
+
+	totalMinutesUsedRollup                = newRollup("actions_total_minutes_used_all", "github actions total minutes used across all owners")
+	totalPaidMinutesUsedRollup            = newRollup("actions_total_paid_minutes_used_all", "github actions total paid minutes used across all owners")
+	includedMinutesRollup                 = newRollup("actions_included_minutes_all", "github actions included minutes across all owners")
+	freeMinutesUsedRollup                 = newRollup("actions_free_minutes_used_all", "github actions free minutes used across all owners")
+	estimatedCostRollup                   = newRollup("actions_estimated_cost_usd_all", "github actions estimated cost in USD across all owners")
+	totalGigabytesBandwidthUsedRollup     = newRollup("packages_total_gigabytes_bandwidth_used_all", "github packages total gigabytes bandwidth used across all owners")
+	totalPaidGigabytesBandwidthUsedRollup = newRollup("packages_total_paid_gigabytes_bandwidth_used_all", "github packages total paid gigabytes bandwidth used across all owners")
+	includedGigabytesBandwidthRollup      = newRollup("packages_included_gigabytes_bandwidth_all", "github packages included gigabytes bandwidth across all owners")
+	estimatedPaidStorageForMonthRollup    = newRollup("shared_storage_estimated_paid_storage_for_month_all", "github shared storage estimated paid storage for month across all owners")
+	estimatedStorageForMonthRollup        = newRollup("shared_storage_estimated_storage_for_month_all", "github shared storage estimated storage for month across all owners")
+
+	actionsCacheUsageBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_cache_usage_bytes",
+			Help: "github actions active caches size in bytes",
+		},
+		[]string{"repository"},
+	)
+	actionsCacheCountGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "actions_cache_count",
+			Help: "github actions active caches count",
+		},
+		[]string{"repository"},
+	)
+
+	costCenterNetAmountGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_cost_center_net_amount",
+			Help: "github enhanced billing net amount in USD per cost center",
+		},
+		[]string{"org", "cost_center"},
+	)
+	costCenterQuantityGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_cost_center_quantity",
+			Help: "github enhanced billing usage quantity per cost center",
+		},
+		[]string{"org", "cost_center", "product", "unit_type"},
+	)
+	usageItemsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_usage_items_total",
+			Help: "number of github enhanced billing usage line items this month",
+		},
+		[]string{"org"},
+	)
+
+	lfsBandwidthUsedBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lfs_bandwidth_used_bytes",
+			Help: "git lfs bandwidth used in bytes",
+		},
+		[]string{"owner"},
+	)
+	lfsStorageUsedBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lfs_storage_used_bytes",
+			Help: "git lfs storage used in bytes",
+		},
+		[]string{"owner"},
+	)
+
+	orgBillingInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_org_billing_info",
+			Help: "billing contact of the github organization",
+		},
+		[]string{"owner", "billing_email"},
+	)
+	copilotSeatsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "copilot_seats",
+			Help: "github copilot seats",
+		},
+		[]string{"owner", "plan_type"},
+	)
+
+	usageNetAmountGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_usage_net_amount_usd",
+			Help: "github enhanced billing net amount per month and product in usd",
+		},
+		[]string{"owner", "month", "product"},
+	)
+	usageQuantityGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_usage_quantity",
+			Help: "github enhanced billing usage quantity per month and product",
+		},
+		[]string{"owner", "month", "product", "unit_type"},
+	)
+
+	spendingLimitUSDGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_spending_limit_usd",
+			Help: "github budgets stopping further usage in usd",
+		},
+		[]string{"owner"},
+	)
+	spendingLimitEnabledGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_spending_limit_enabled",
+			Help: "whether a github budget stops further usage",
+		},
+		[]string{"owner"},
+	)
+
+	consecutiveFailuresGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_consecutive_failures",
+			Help: "number of consecutive failed collection cycles",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	endpointAccessibleGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_endpoint_accessible",
+			Help: "whether the token could read the github billing endpoint of the owner",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	ssoAuthorizationRequiredGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_sso_authorization_required",
+			Help: "1 if the token has to be authorized for the owner's saml single sign-on",
+		},
+		[]string{"owner"},
+	)
+	timeSkewGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_time_skew_seconds",
+			Help: "seconds the local clock is ahead of the date header of the latest github response",
+		},
+		[]string{"owner"},
+	)
+	collectorRestartsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_billing_collector_restarts_total",
+			Help: "number of times a stuck collection loop was restarted",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	repoSeriesDroppedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "github_billing_repo_series_dropped_total",
+			Help: "number of repositories not collected over the max repo series",
+		},
+	)
+	hedgedRequestsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "github_billing_hedged_requests_total",
+			Help: "number of second requests sent for slow github api requests",
+		},
+	)
+	responseBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_billing_response_bytes_total",
+			Help: "number of response body bytes read from the github api",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	inGracePeriodGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_in_grace_period",
+			Help: "1 while the billing values of the owner are held after a billing cycle rollover",
+		},
+		[]string{"owner"},
+	)
+	upGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_up",
+			Help: "1 if the last collection cycle of every endpoint of the owner succeeded",
+		},
+		[]string{"owner"},
+	)
+	scrapeSuccessGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_scrape_success",
+			Help: "1 if the last collection cycle succeeded",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	decodeDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_billing_decode_duration_seconds",
+			Help:    "seconds spent decoding github api response bodies",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+		},
+		[]string{"owner", "endpoint"},
+	)
+	// scrapeDurationHistogram is created by registerMetrics, as native
+	// histograms are opt-in.
+	scrapeDurationHistogram *prometheus.HistogramVec
+	loopSleepSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_billing_loop_sleep_seconds_total",
+			Help: "seconds spent waiting for the next refresh",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	rateLimitWaitSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_billing_ratelimit_wait_seconds_total",
+			Help: "seconds spent waiting for the rate limit, retrying after it or delaying a refresh",
+		},
+		[]string{"owner"},
+	)
+	loopWorkSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_billing_loop_work_seconds_total",
+			Help: "seconds spent collecting billing",
+		},
+		[]string{"owner", "endpoint"},
+	)
+	ownerInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_owner_info",
+			Help: "type of the billing owner",
+		},
+		[]string{"owner", "owner_type"},
+	)
+	startTimeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_billing_exporter_start_time_seconds",
+			Help: "unix time the exporter started at",
+		},
+	)
+	targetInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_target_info",
+			Help: "github api base url the exporter collects from",
+		},
+		[]string{"base_url"},
+	)
+	billingPlatformGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_platform",
+			Help: "billing platform of the owner, classic or enhanced",
+		},
+		[]string{"owner", "platform"},
+	)
+	ownersTotalGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_billing_owners_total",
+			Help: "number of configured billing owners",
+		},
+	)
+	discoveredOwnersTotalGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_billing_discovered_owners_total",
+			Help: "number of organizations found by auto-discovery whose billing is readable",
+		},
+	)
+	skippedOwnersTotalGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_skipped_owners_total",
+			Help: "number of organizations found by auto-discovery whose billing isn't readable",
+		},
+		[]string{"reason"},
+	)
+	workerPoolSizeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_billing_worker_pool_size",
+			Help: "maximum number of github api requests in flight",
+		},
+	)
+	inflightRequestsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_billing_inflight_requests",
+			Help: "number of github api requests in flight",
+		},
+	)
+	tokenScopesInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_token_scopes_info",
+			Help: "oauth scopes granted to the github token",
+		},
+		[]string{"owner", "scopes"},
+	)
+	rateLimitLimitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_ratelimit_limit",
+			Help: "github api requests or graphql points allowed per rate limit window",
+		},
+		[]string{"owner", "resource"},
+	)
+	rateLimitRemainingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_ratelimit_remaining",
+			Help: "github api requests or graphql points remaining in the rate limit window",
+		},
+		[]string{"owner", "resource"},
+	)
+	rateLimitUsedRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_ratelimit_used_ratio",
+			Help: "fraction of the github api rate limit window used, of the resource closest to exhaustion",
+		},
+		[]string{"owner"},
+	)
+	schedulerDelaySecondsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_billing_scheduler_delay_seconds",
+			Help: "seconds the next cycle is delayed beyond the refresh interval to spare the rate limit",
+		},
+		[]string{"owner", "resource"},
+	)
 )
 
+// runnerOS are always exported so that an OS missing from the breakdown
+// is reset to 0 instead of keeping the value from a previous cycle.
+var runnerOS = []string{"ubuntu", "macos", "windows"}
+
 type actionsBilling struct {
-	TotalMinutesUsed     int    `json:"total_minutes_used"`
-	TotalPaidMinutesUsed string `json:"total_paid_minutes_used"`
-	IncludedMinutes      int    `json:"included_minutes"`
-	MinutesUsedBreakdown struct {
-		UBUNTU  int `json:"UBUNTU"`
-		MACOS   int `json:"MACOS"`
-		WINDOWS int `json:"WINDOWS"`
-	} `json:"minutes_used_breakdown"`
+	TotalMinutesUsed     int            `json:"total_minutes_used"`
+	TotalPaidMinutesUsed string         `json:"total_paid_minutes_used"`
+	IncludedMinutes      int            `json:"included_minutes"`
+	MinutesUsedBreakdown map[string]int `json:"minutes_used_breakdown"`
+
+	// unlimited tells included minutes which aren't a limit, see
+	// includedMinutesUnlimited.
+	unlimited bool
 }
 
 type packagesBilling struct {
@@ -117,160 +567,919 @@ type sharedStorageBilling struct {
 	EstimatedStorageForMonth     int `json:"estimated_storage_for_month"`
 }
 
-func init() {
-	prometheus.MustRegister(totalMinutesUsedGauge)
-	prometheus.MustRegister(totalPaidMinutesUsedGauge)
-	prometheus.MustRegister(includedMinutesGauge)
-	prometheus.MustRegister(minutesUsedBreakdownGauge)
+// copilotBilling is decoded leniently, plan_type was added to the response
+// later and the seat breakdown is missing without a subscription.
+type copilotBilling struct {
+	SeatBreakdown *struct {
+		Total int `json:"total"`
+	} `json:"seat_breakdown"`
+	PlanType string `json:"plan_type"`
+}
 
-	prometheus.MustRegister(totalGigabytesBandwidthUsedGauge)
-	prometheus.MustRegister(totalPaidGigabytesBandwidthUsedGauge)
-	prometheus.MustRegister(includedGigabytesBandwidthGauge)
+// organization is the part of GET /orgs/{org} with the billing contact,
+// billing_email is only returned to owners of the organization.
+type organization struct {
+	BillingEmail string `json:"billing_email"`
+}
 
-	prometheus.MustRegister(daysLeftInBillingCycleGauge)
-	prometheus.MustRegister(estimatedPaidStorageForMonthGauge)
-	prometheus.MustRegister(estimatedStorageForMonthGauge)
+type actionsCacheUsage struct {
+	FullName                string `json:"full_name"`
+	ActiveCachesSizeInBytes int64  `json:"active_caches_size_in_bytes"`
+	ActiveCachesCount       int    `json:"active_caches_count"`
 }
 
-func getGitHubActionsBilling(mode apiMode, args *Args) {
-	var (
-		client  = &http.Client{}
-		baseURL string
-		owner   string
-	)
+type enterpriseBillingInfo struct {
+	Enterprise struct {
+		BillingInfo struct {
+			TotalLicenses           int `json:"totalLicenses"`
+			TotalAvailableLicenses  int `json:"totalAvailableLicenses"`
+			AllLicensableUsersCount int `json:"allLicensableUsersCount"`
+		} `json:"billingInfo"`
+	} `json:"enterprise"`
+}
+
+const enterpriseBillingInfoQuery = `query($slug: String!) {
+  enterprise(slug: $slug) {
+    billingInfo {
+      totalLicenses
+      totalAvailableLicenses
+      allLicensableUsersCount
+    }
+  }
+}`
+
+type lfsBillingInfo struct {
+	Enterprise struct {
+		// BillingInfo is null for enterprises without Git LFS billing.
+		BillingInfo *struct {
+			BandwidthUsage float64 `json:"bandwidthUsage"`
+			StorageUsage   float64 `json:"storageUsage"`
+		} `json:"billingInfo"`
+	} `json:"enterprise"`
+}
+
+const lfsBillingInfoQuery = `query($slug: String!) {
+  enterprise(slug: $slug) {
+    billingInfo {
+      bandwidthUsage
+      storageUsage
+    }
+  }
+}`
+
+// billingMetrics are the metrics which can be selected with EnabledMetrics,
+// keyed by metric name. An endpoint is only polled when at least one of its
+// metrics is enabled.
+var billingMetrics = map[string]struct {
+	endpoint  string
+	collector prometheus.Collector
+}{
+	"actions_total_minutes_used":      {"actions", totalMinutesUsedGauge},
+	"actions_total_paid_minutes_used": {"actions", totalPaidMinutesUsedGauge},
+	"actions_included_minutes":        {"actions", includedMinutesGauge},
+	"actions_minutes_used_breakdown":  {"actions", minutesUsedBreakdownGauge},
+	"actions_free_minutes_used":       {"actions", freeMinutesUsedGauge},
+	"actions_estimated_cost_usd":      {"actions", estimatedCostGauge},
+	"actions_macos_minutes_ratio":     {"actions", macosMinutesRatioGauge},
+	"actions_days_until_exhaustion":   {"actions", daysUntilExhaustionGauge},
+	"github_actions_billing_raw":      {"actions", actionsBillingRawGauge},
+	"actions_minutes":                 {"actions", actionsMinutesGauge},
+	"actions_paid_usage_active":       {"actions", actionsPaidUsageActiveGauge},
+	"actions_plan_unlimited":          {"actions", actionsPlanUnlimitedGauge},
+	"actions_self_hosted_minutes":     {"actions", actionsSelfHostedMinutesGauge},
+
+	"github_billing_usage_net_amount_usd": {"actions", usageNetAmountGauge},
+	"github_billing_usage_quantity":       {"actions", usageQuantityGauge},
 
-	switch mode {
+	"packages_total_gigabytes_bandwidth_used":      {"packages", totalGigabytesBandwidthUsedGauge},
+	"packages_total_paid_gigabytes_bandwidth_used": {"packages", totalPaidGigabytesBandwidthUsedGauge},
+	"packages_included_gigabytes_bandwidth":        {"packages", includedGigabytesBandwidthGauge},
+	"packages_paid_usage_active":                   {"packages", packagesPaidUsageActiveGauge},
+	"packages_paid_bandwidth_ratio":                {"packages", packagesPaidBandwidthRatioGauge},
+
+	"shared_storage_days_left_in_billing_cycle":       {"shared_storage", daysLeftInBillingCycleGauge},
+	"shared_storage_estimated_paid_storage_for_month": {"shared_storage", estimatedPaidStorageForMonthGauge},
+	"shared_storage_estimated_storage_for_month":      {"shared_storage", estimatedStorageForMonthGauge},
+	"shared_storage_free_estimate":                    {"shared_storage", sharedStorageFreeEstimateGauge},
+	"billing_cycle_seconds_elapsed":                   {"shared_storage", billingCycleSecondsElapsedGauge},
+
+	"actions_cache_usage_bytes": {"cache", actionsCacheUsageBytesGauge},
+	"actions_cache_count":       {"cache", actionsCacheCountGauge},
+
+	"github_cost_center_net_amount":    {"cost_centers", costCenterNetAmountGauge},
+	"github_cost_center_quantity":      {"cost_centers", costCenterQuantityGauge},
+	"github_billing_usage_items_total": {"cost_centers", usageItemsGauge},
+
+	"enterprise_licenses":           {"licenses", enterpriseLicensesGauge},
+	"enterprise_available_licenses": {"licenses", enterpriseAvailableLicensesGauge},
+	"enterprise_licensable_users":   {"licenses", enterpriseLicensableUsersGauge},
+
+	"lfs_bandwidth_used_bytes": {"lfs", lfsBandwidthUsedBytesGauge},
+	"lfs_storage_used_bytes":   {"lfs", lfsStorageUsedBytesGauge},
+
+	"copilot_seats": {"copilot", copilotSeatsGauge},
+
+	"github_org_billing_info": {"billing_info", orgBillingInfoGauge},
+
+	"github_billing_spending_limit_usd":     {"budgets", spendingLimitUSDGauge},
+	"github_billing_spending_limit_enabled": {"budgets", spendingLimitEnabledGauge},
+
+	"actions_total_minutes_used_all":                      {"actions", totalMinutesUsedRollup.gauge},
+	"actions_total_paid_minutes_used_all":                 {"actions", totalPaidMinutesUsedRollup.gauge},
+	"actions_included_minutes_all":                        {"actions", includedMinutesRollup.gauge},
+	"actions_free_minutes_used_all":                       {"actions", freeMinutesUsedRollup.gauge},
+	"actions_estimated_cost_usd_all":                      {"actions", estimatedCostRollup.gauge},
+	"packages_total_gigabytes_bandwidth_used_all":         {"packages", totalGigabytesBandwidthUsedRollup.gauge},
+	"packages_total_paid_gigabytes_bandwidth_used_all":    {"packages", totalPaidGigabytesBandwidthUsedRollup.gauge},
+	"packages_included_gigabytes_bandwidth_all":           {"packages", includedGigabytesBandwidthRollup.gauge},
+	"shared_storage_estimated_paid_storage_for_month_all": {"shared_storage", estimatedPaidStorageForMonthRollup.gauge},
+	"shared_storage_estimated_storage_for_month_all":      {"shared_storage", estimatedStorageForMonthRollup.gauge},
+}
+
+// knownEndpoints are the billing endpoints collectors can be enabled for.
+func knownEndpoints() map[string]bool {
+	endpoints := make(map[string]bool)
+	for _, m := range billingMetrics {
+		endpoints[m.endpoint] = true
+	}
+
+	return endpoints
+}
+
+// enabledMetrics resolves the current names of the enabled billing metrics,
+// accepting their legacy names as well.
+func enabledMetrics(names []string) (map[string]bool, error) {
+	currentNames := make(map[string]string, len(legacyMetricNames))
+	for current, legacy := range legacyMetricNames {
+		currentNames[legacy] = current
+	}
+
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		if current, ok := currentNames[name]; ok {
+			name = current
+		}
+		if _, ok := billingMetrics[name]; !ok {
+			return nil, xerrors.Errorf("unknown metric %q", name)
+		}
+		enabled[name] = true
+	}
+
+	return enabled, nil
+}
+
+// registerMetrics registers the enabled billing metrics along with the
+// exporter's own metrics and returns the endpoints which need to be polled.
+func registerMetrics(args *Args) (map[string]bool, error) {
+	enabled, err := enabledMetrics(args.EnabledMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]bool)
+	for name, m := range billingMetrics {
+		if (len(enabled) > 0 && !enabled[name]) || !args.collectorEnabled(m.endpoint) {
+			continue
+		}
+		var c prometheus.Collector = m.collector
+		if args.EmitGitHubTimestamps {
+			c = timestampCollector{m.collector}
+		}
+		if _, err := register(c); err != nil {
+			return nil, err
+		}
+		endpoints[m.endpoint] = true
+
+		if legacy, ok := legacyMetricNames[name]; ok && args.EmitLegacyMetricNames {
+			if err := registerAlias(legacy, name, m.collector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	opts := prometheus.HistogramOpts{
+		Name: "github_billing_scrape_duration_seconds",
+		Help: "seconds spent collecting billing per cycle",
+	}
+	if args.NativeHistograms {
+		opts.NativeHistogramBucketFactor = 1.1
+		opts.NativeHistogramMaxBucketNumber = 100
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	scrapeDurationHistogram = prometheus.NewHistogramVec(opts, []string{"owner", "endpoint"})
+
+	existing, err := register(scrapeDurationHistogram)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := existing.(*prometheus.HistogramVec); ok {
+		scrapeDurationHistogram = h
+	}
+
+	for _, c := range []prometheus.Collector{
+		consecutiveFailuresGauge,
+		scrapeSuccessGauge,
+		upGauge,
+		inGracePeriodGauge,
+		collectorRestartsCounter,
+		responseBytesCounter,
+		decodeDurationHistogram,
+		timeSkewGauge,
+		ssoAuthorizationRequiredGauge,
+		endpointAccessibleGauge,
+		loopSleepSecondsCounter,
+		loopWorkSecondsCounter,
+		rateLimitWaitSecondsCounter,
+		ownerInfoGauge,
+		startTimeGauge,
+		targetInfoGauge,
+		billingPlatformGauge,
+		ownersTotalGauge,
+		discoveredOwnersTotalGauge,
+		skippedOwnersTotalGauge,
+		workerPoolSizeGauge,
+		inflightRequestsGauge,
+		hedgedRequestsCounter,
+		repoSeriesDroppedCounter,
+		tokenScopesInfoGauge,
+		rateLimitLimitGauge,
+		rateLimitRemainingGauge,
+		rateLimitUsedRatioGauge,
+		schedulerDelaySecondsGauge,
+	} {
+		if _, err := register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return endpoints, nil
+}
+
+// register is prometheus.Register tolerating a collector registered before,
+// e.g. by an earlier Run of an embedding program or test, in which case the
+// registered one is returned to be reused.
+func register(c prometheus.Collector) (prometheus.Collector, error) {
+	if err := prometheus.Register(c); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if xerrors.As(err, &alreadyRegistered) {
+			return alreadyRegistered.ExistingCollector, nil
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func billingPath(o account, resource string) string {
+	switch o.mode {
 	case orgMode:
-		baseURL = fmt.Sprintf("https://api.github.com/orgs/%s/settings/billing/actions", args.Organization)
-		owner = args.Organization
+		return fmt.Sprintf("/orgs/%s/settings/billing/%s", url.PathEscape(o.name), resource)
 	case userMode:
-		baseURL = fmt.Sprintf("https://api.github.com/users/%s/settings/billing/actions", args.User)
-		owner = args.User
+		return fmt.Sprintf("/users/%s/settings/billing/%s", url.PathEscape(o.name), resource)
+	case enterpriseMode:
+		return fmt.Sprintf("/enterprises/%s/settings/billing/%s", url.PathEscape(o.name), resource)
 	default:
 		log.Fatal("Invalid select mode")
 	}
 
+	return ""
+}
+
+func poll(ctx context.Context, owner, endpoint string, args *Args, collect func(ctx context.Context) error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	trigger, unsubscribe := subscribeRefresh(owner)
+	defer unsubscribe()
+
+	next := time.Now()
+	var delay time.Duration
 	for {
-		var p actionsBilling
-		req, err := http.NewRequest("GET", baseURL, nil)
-		if err != nil {
-			log.Fatal(err)
+		reportProgress(ctx, owner, endpoint, next)
+		sleepStart := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-trigger:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			delay = 0
 		}
-		req.Header.Set("Authorization", fmt.Sprintf("token %s", args.Token))
+		loopSleepSecondsCounter.WithLabelValues(owner, endpoint).Add(time.Since(sleepStart).Seconds())
+		rateLimitWaitSecondsCounter.WithLabelValues(owner).Add(delay.Seconds())
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Fatal(err)
+		workStart := time.Now()
+		reportProgress(ctx, owner, endpoint, workStart.Add(args.scrapeTimeout(owner)))
+		cycleCtx, cancel := context.WithTimeout(withEndpoint(withOwner(ctx, owner), endpoint), args.scrapeTimeout(owner))
+		err := collect(cycleCtx)
+		cancel()
+		loopWorkSecondsCounter.WithLabelValues(owner, endpoint).Add(time.Since(workStart).Seconds())
+		scrapeDurationHistogram.WithLabelValues(owner, endpoint).Observe(time.Since(workStart).Seconds())
+		if ctx.Err() != nil {
+			return
 		}
+		recordEndpointAccess(owner, endpoint, err)
 
-		err = json.NewDecoder(resp.Body).Decode(&p)
-		if err != nil {
-			log.Fatal(err)
+		if xerrors.Is(err, errEmptyBody) {
+			debugf(ctx, "Skipped %s billing for %s: %v\n", endpoint, owner, err)
+			err = nil
+		}
+
+		if unavailableToWorkflowToken(err, args) {
+			log.Printf("%s billing for %s isn't available to the workflow token, no longer collecting it: %v\n", endpoint, owner, err)
+			scrapeSuccessGauge.WithLabelValues(owner, endpoint).Set(0)
+			return
 		}
-		resp.Body.Close()
 
-		f, err := strconv.ParseFloat(p.TotalPaidMinutesUsed, 64)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Failed to collect %s billing for %s: %v\n", endpoint, owner, err)
+			consecutiveFailuresGauge.WithLabelValues(owner, endpoint).Inc()
+			scrapeSuccessGauge.WithLabelValues(owner, endpoint).Set(0)
+		} else {
+			consecutiveFailuresGauge.WithLabelValues(owner, endpoint).Set(0)
+			scrapeSuccessGauge.WithLabelValues(owner, endpoint).Set(1)
+		}
+		setOwnerUp(owner, endpoint, err == nil)
+		recordSSOAuthorization(owner, err)
+		if args.TextfileOutput != "" {
+			writeTextfile(args)
+		}
+
+		delay = schedulerDelay(owner, endpointResource(endpoint), time.Now())
+		if delay > 0 {
+			log.Printf("Rate limit almost exhausted, delaying %s billing for %s by %v\n", endpoint, owner, delay)
+		}
+		interval := nextInterval(args, time.Now(), randFloat64) + delay
+		timer.Reset(interval)
+		next = time.Now().Add(interval)
+	}
+}
+
+func getGitHubActionsBilling(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := billingPath(o, "actions"), args.label(o)
+
+	// Owners moved to the enhanced billing platform stay there, so the
+	// classic endpoint isn't requested anymore once it is gone.
+	enhanced := false
+	poll(ctx, owner, "actions", args, func(ctx context.Context) error {
+		if enhanced {
+			return getGitHubActionsUsage(ctx, client, o, args)
 		}
 
-		totalMinutesUsedGauge.WithLabelValues(owner).Set(float64(p.TotalMinutesUsed))
-		totalPaidMinutesUsedGauge.WithLabelValues(owner).Set(f)
-		includedMinutesGauge.WithLabelValues(owner).Set(float64(p.IncludedMinutes))
-		minutesUsedBreakdownGauge.WithLabelValues(owner, "ubuntu").Set(float64(p.MinutesUsedBreakdown.UBUNTU))
-		minutesUsedBreakdownGauge.WithLabelValues(owner, "macos").Set(float64(p.MinutesUsedBreakdown.MACOS))
-		minutesUsedBreakdownGauge.WithLabelValues(owner, "windows").Set(float64(p.MinutesUsedBreakdown.WINDOWS))
+		var raw json.RawMessage
+		if err := fetch(ctx, client, path, args, &raw); err != nil {
+			if isEnhancedBilling(err) {
+				log.Printf("%s moved to the enhanced billing platform, collecting its Actions usage report instead\n", owner)
+				enhanced = true
+				return getGitHubActionsUsage(ctx, client, o, args)
+			}
+			return err
+		}
+		setBillingPlatform(owner, "classic")
 
-		time.Sleep(time.Duration(args.Refresh) * time.Second)
+		var p actionsBilling
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+		p.unlimited = includedMinutesUnlimited(raw, &p, args)
+		if args.EmitRawFields {
+			setActionsRawFields(owner, raw)
+		}
+
+		if args.CSVOutput != "" {
+			appendCSV(args, owner, "actions", &p)
+		}
+
+		return setActionsBilling(owner, &p, args)
+	})
+}
+
+// getGitHubActionsUsage sets the Actions gauges from the enhanced billing
+// usage report, which doesn't report included minutes.
+func getGitHubActionsUsage(ctx context.Context, client *http.Client, o account, args *Args) error {
+	items, err := fetchUsageItems(ctx, client, ownerUsagePath(o, time.Now()), args)
+	if err != nil {
+		return err
+	}
+	owner := args.label(o)
+	setBillingPlatform(owner, "enhanced")
+	setMonthlyUsage(ctx, client, o, owner, items, args)
+
+	p := actionsBillingFromUsage(items)
+	if args.CSVOutput != "" {
+		appendCSV(args, owner, "actions", p)
 	}
+	if err := setActionsBilling(owner, p, args); err != nil {
+		return err
+	}
+	deleteIncludedMinutes(owner)
+	actionsPlanUnlimitedGauge.DeleteLabelValues(owner)
+	// The usage report has no self-hosted minutes, the difference would only
+	// be SKUs of other runners.
+	actionsSelfHostedMinutesGauge.DeleteLabelValues(owner)
+
+	return nil
 }
 
-func getGitHubPackagesBilling(mode apiMode, args *Args) {
-	var (
-		client  = &http.Client{}
-		baseURL string
-		owner   string
-	)
+// includedMinutesUnlimited reports whether the included minutes of a plan
+// are unlimited, e.g. of free plans for open-source organizations, which
+// either leave included_minutes out or report a sentinel of at least
+// args.UnlimitedIncludedMinutes.
+func includedMinutesUnlimited(raw json.RawMessage, p *actionsBilling, args *Args) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	if v, ok := fields["included_minutes"]; !ok || string(v) == "null" {
+		return true
+	}
 
-	switch mode {
-	case orgMode:
-		baseURL = fmt.Sprintf("https://api.github.com/orgs/%s/settings/billing/packages", args.Organization)
-		owner = args.Organization
-	case userMode:
-		baseURL = fmt.Sprintf("https://api.github.com/users/%s/settings/billing/packages", args.User)
-		owner = args.User
-	default:
-		log.Fatal("Invalid select mode")
+	return args.UnlimitedIncludedMinutes > 0 && p.IncludedMinutes >= args.UnlimitedIncludedMinutes
+}
+
+// deleteIncludedMinutes drops the series derived from the included minutes
+// of an owner which has none, or no limit of them.
+func deleteIncludedMinutes(owner string) {
+	includedMinutesGauge.DeleteLabelValues(owner)
+	actionsMinutesGauge.DeleteLabelValues(owner, "included")
+	daysUntilExhaustionGauge.DeleteLabelValues(owner)
+}
+
+func setActionsBilling(owner string, p *actionsBilling, args *Args) error {
+	f, err := parsePaidMinutes(p.TotalPaidMinutesUsed, args.DecimalSeparator)
+	if err != nil {
+		return xerrors.Errorf("invalid total_paid_minutes_used %q: %w", p.TotalPaidMinutesUsed, err)
+	}
+	if holdBilling(owner, args, time.Now()) {
+		return nil
 	}
 
-	for {
+	breakdown := make(map[string]float64, len(runnerOS))
+	for _, os := range runnerOS {
+		breakdown[os] = 0
+	}
+	for os, minutes := range p.MinutesUsedBreakdown {
+		breakdown[strings.ToLower(os)] += float64(minutes)
+	}
+
+	freeMinutes := math.Max(float64(p.TotalMinutesUsed)-f, 0)
+	cost := breakdown["ubuntu"]*args.PricePerMinuteUbuntu +
+		breakdown["macos"]*args.PricePerMinuteMacos +
+		breakdown["windows"]*args.PricePerMinuteWindows
+
+	// Owners below the threshold still count towards the rollups, so the
+	// totals stay exact.
+	if args.EmitRollups {
+		totalMinutesUsedRollup.set(owner, float64(p.TotalMinutesUsed))
+		totalPaidMinutesUsedRollup.set(owner, f)
+		if p.unlimited {
+			includedMinutesRollup.set(owner, 0)
+		} else {
+			includedMinutesRollup.set(owner, float64(p.IncludedMinutes))
+		}
+		freeMinutesUsedRollup.set(owner, freeMinutes)
+		estimatedCostRollup.set(owner, cost)
+	}
+
+	if p.TotalMinutesUsed < args.MinMinutesThreshold {
+		deleteActionsBilling(owner)
+		return nil
+	}
+
+	totalMinutesUsedGauge.WithLabelValues(owner).Set(float64(p.TotalMinutesUsed))
+	totalPaidMinutesUsedGauge.WithLabelValues(owner).Set(f)
+	includedMinutesGauge.WithLabelValues(owner).Set(float64(p.IncludedMinutes))
+	actionsPlanUnlimitedGauge.WithLabelValues(owner).Set(boolToFloat(p.unlimited))
+	if args.LogScrapeResults {
+		log.Printf("Actions billing for %s: %d of %d included minutes used, %v paid\n", owner, p.TotalMinutesUsed, p.IncludedMinutes, f)
+	}
+
+	var breakdownMinutes float64
+	for os, minutes := range breakdown {
+		minutesUsedBreakdownGauge.WithLabelValues(owner, os).Set(minutes)
+		breakdownMinutes += minutes
+	}
+	// Self-hosted minutes are free, so they count towards the total but
+	// not towards the breakdown by runner OS.
+	actionsSelfHostedMinutesGauge.WithLabelValues(owner).Set(math.Max(float64(p.TotalMinutesUsed)-breakdownMinutes, 0))
+	freeMinutesUsedGauge.WithLabelValues(owner).Set(freeMinutes)
+	estimatedCostGauge.WithLabelValues(owner).Set(cost)
+
+	var macosRatio float64
+	if p.TotalMinutesUsed > 0 {
+		macosRatio = breakdown["macos"] / float64(p.TotalMinutesUsed)
+	}
+	macosMinutesRatioGauge.WithLabelValues(owner).Set(macosRatio)
+	actionsPaidUsageActiveGauge.WithLabelValues(owner).Set(boolToFloat(f > 0))
+	if elapsed, ok := daysElapsedInBillingCycle(owner, time.Now()); ok {
+		days := daysUntilExhaustion(float64(p.TotalMinutesUsed), float64(p.IncludedMinutes), elapsed)
+		daysUntilExhaustionGauge.WithLabelValues(owner).Set(days)
+	}
+
+	if args.EmitMinutesByKind {
+		actionsMinutesGauge.WithLabelValues(owner, "included").Set(float64(p.IncludedMinutes))
+		actionsMinutesGauge.WithLabelValues(owner, "used").Set(float64(p.TotalMinutesUsed))
+		actionsMinutesGauge.WithLabelValues(owner, "paid").Set(f)
+	}
+	if p.unlimited {
+		deleteIncludedMinutes(owner)
+	}
+
+	return nil
+}
+
+// deleteActionsBilling drops the Actions series of an owner which fell
+// below --min-minutes-threshold, e.g. at the start of a billing cycle.
+func deleteActionsBilling(owner string) {
+	for _, g := range []*prometheus.GaugeVec{
+		totalMinutesUsedGauge,
+		totalPaidMinutesUsedGauge,
+		includedMinutesGauge,
+		minutesUsedBreakdownGauge,
+		freeMinutesUsedGauge,
+		estimatedCostGauge,
+		macosMinutesRatioGauge,
+		actionsPaidUsageActiveGauge,
+		daysUntilExhaustionGauge,
+		actionsPlanUnlimitedGauge,
+		actionsSelfHostedMinutesGauge,
+		actionsMinutesGauge,
+	} {
+		g.DeletePartialMatch(prometheus.Labels{"owner": owner})
+	}
+}
+
+// knownActionsFields are the fields of actionsBilling, which already have
+// their own metrics.
+var knownActionsFields = map[string]bool{
+	"total_minutes_used":      true,
+	"total_paid_minutes_used": true,
+	"included_minutes":        true,
+	"minutes_used_breakdown":  true,
+}
+
+// setActionsRawFields exports the numeric top-level fields of an Actions
+// billing response which aren't known yet, e.g. ones GitHub adds later.
+func setActionsRawFields(owner string, raw json.RawMessage) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return
+	}
+
+	for field, value := range fields {
+		if knownActionsFields[field] {
+			continue
+		}
+		var f float64
+		if err := json.Unmarshal(value, &f); err != nil {
+			continue
+		}
+		actionsBillingRawGauge.WithLabelValues(owner, field).Set(f)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// parsePaidMinutes parses total_paid_minutes_used, which GitHub returns as
+// a string. A null or empty value means nothing was paid.
+//
+// Some GitHub Enterprise Server versions return localized values such as
+// "1.234,50 USD". They are only accepted with a decimal separator, which
+// strips thousands separators and currencies from a value failing to parse
+// as is.
+func parsePaidMinutes(s, decimalSeparator string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil || decimalSeparator == "" {
+		return f, err
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9' || r == '-':
+			return r
+		case string(r) == decimalSeparator:
+			return '.'
+		default:
+			// Thousands separators, spaces and currencies.
+			return -1
+		}
+	}, s)
+
+	return strconv.ParseFloat(digits, 64)
+}
+
+func getGitHubPackagesBilling(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := billingPath(o, "packages"), args.label(o)
+
+	poll(ctx, owner, "packages", args, func(ctx context.Context) error {
 		var p packagesBilling
-		req, err := http.NewRequest("GET", baseURL, nil)
-		if err != nil {
-			log.Fatal(err)
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			if isEnhancedBilling(err) {
+				setBillingPlatform(owner, "enhanced")
+				return skipped(err, "not available on the enhanced billing platform")
+			}
+			return err
 		}
-		req.Header.Set("Authorization", fmt.Sprintf("token %s", args.Token))
+		setBillingPlatform(owner, "classic")
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Fatal(err)
+		if args.CSVOutput != "" {
+			appendCSV(args, owner, "packages", &p)
 		}
 
-		err = json.NewDecoder(resp.Body).Decode(&p)
-		if err != nil {
-			log.Fatal(err)
+		setPackagesBilling(owner, &p, args)
+		return nil
+	})
+}
+
+func setPackagesBilling(owner string, p *packagesBilling, args *Args) {
+	if holdBilling(owner, args, time.Now()) {
+		return
+	}
+	totalGigabytesBandwidthUsedGauge.WithLabelValues(owner).Set(float64(p.TotalGigabytesBandwidthUsed))
+	totalPaidGigabytesBandwidthUsedGauge.WithLabelValues(owner).Set(float64(p.TotalPaidGigabytesBandwidthUsed))
+	includedGigabytesBandwidthGauge.WithLabelValues(owner).Set(float64(p.IncludedGigabytesBandwidth))
+	if args.LogScrapeResults {
+		log.Printf("Packages billing for %s: %d of %d included GB of bandwidth used, %d paid\n", owner, p.TotalGigabytesBandwidthUsed, p.IncludedGigabytesBandwidth, p.TotalPaidGigabytesBandwidthUsed)
+	}
+	packagesPaidUsageActiveGauge.WithLabelValues(owner).Set(boolToFloat(p.TotalPaidGigabytesBandwidthUsed > 0))
+
+	var paidRatio float64
+	if p.IncludedGigabytesBandwidth > 0 {
+		paidRatio = float64(p.TotalPaidGigabytesBandwidthUsed) / float64(p.IncludedGigabytesBandwidth)
+	}
+	packagesPaidBandwidthRatioGauge.WithLabelValues(owner).Set(paidRatio)
+
+	if args.EmitRollups {
+		totalGigabytesBandwidthUsedRollup.set(owner, float64(p.TotalGigabytesBandwidthUsed))
+		totalPaidGigabytesBandwidthUsedRollup.set(owner, float64(p.TotalPaidGigabytesBandwidthUsed))
+		includedGigabytesBandwidthRollup.set(owner, float64(p.IncludedGigabytesBandwidth))
+	}
+}
+
+func getGitHubSharedStorageBilling(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := billingPath(o, "shared-storage"), args.label(o)
+
+	poll(ctx, owner, "shared_storage", args, func(ctx context.Context) error {
+		var p sharedStorageBilling
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			if isEnhancedBilling(err) {
+				setBillingPlatform(owner, "enhanced")
+				return skipped(err, "not available on the enhanced billing platform")
+			}
+			return err
+		}
+		setBillingPlatform(owner, "classic")
+
+		if args.CSVOutput != "" {
+			appendCSV(args, owner, "shared_storage", &p)
 		}
-		resp.Body.Close()
 
-		totalGigabytesBandwidthUsedGauge.WithLabelValues(owner).Set(float64(p.TotalGigabytesBandwidthUsed))
-		totalPaidGigabytesBandwidthUsedGauge.WithLabelValues(owner).Set(float64(p.TotalPaidGigabytesBandwidthUsed))
-		includedGigabytesBandwidthGauge.WithLabelValues(owner).Set(float64(p.IncludedGigabytesBandwidth))
+		setSharedStorageBilling(owner, &p, args)
+		return nil
+	})
+}
 
-		time.Sleep(time.Duration(args.Refresh) * time.Second)
+func setSharedStorageBilling(owner string, p *sharedStorageBilling, args *Args) {
+	now := time.Now()
+	daysLeftInBillingCycleGauge.WithLabelValues(owner).Set(float64(p.DaysLeftInBillingCycle))
+	setDaysLeftInBillingCycle(owner, p.DaysLeftInBillingCycle, now)
+	if elapsed, ok := secondsElapsedInBillingCycle(owner, now); ok {
+		billingCycleSecondsElapsedGauge.WithLabelValues(owner).Set(elapsed)
+	}
+	if holdBilling(owner, args, now) {
+		return
+	}
+	estimatedPaidStorageForMonthGauge.WithLabelValues(owner).Set(float64(p.EstimatedPaidStorageForMonth))
+	estimatedStorageForMonthGauge.WithLabelValues(owner).Set(float64(p.EstimatedStorageForMonth))
+	sharedStorageFreeEstimateGauge.WithLabelValues(owner).Set(math.Max(float64(p.EstimatedStorageForMonth-p.EstimatedPaidStorageForMonth), 0))
+	if args.LogScrapeResults {
+		log.Printf("Shared storage billing for %s: %d GB estimated this month, %d paid, %d days left in the billing cycle\n", owner, p.EstimatedStorageForMonth, p.EstimatedPaidStorageForMonth, p.DaysLeftInBillingCycle)
+	}
+
+	if args.EmitRollups {
+		estimatedPaidStorageForMonthRollup.set(owner, float64(p.EstimatedPaidStorageForMonth))
+		estimatedStorageForMonthRollup.set(owner, float64(p.EstimatedStorageForMonth))
 	}
 }
 
-func getGitHubSharedStorageBilling(mode apiMode, args *Args) {
-	var (
-		client  = &http.Client{}
-		baseURL string
-		owner   string
-	)
+func getGitHubEnterpriseLicenses(ctx context.Context, client *http.Client, args *Args) {
+	owner := args.label(account{mode: enterpriseMode, name: args.GraphQLEnterprise})
+	variables := map[string]interface{}{"slug": args.GraphQLEnterprise}
 
-	switch mode {
-	case orgMode:
-		baseURL = fmt.Sprintf("https://api.github.com/orgs/%s/settings/billing/shared-storage", args.Organization)
-		owner = args.Organization
-	case userMode:
-		baseURL = fmt.Sprintf("https://api.github.com/users/%s/settings/billing/shared-storage", args.User)
-		owner = args.User
-	default:
-		log.Fatal("Invalid select mode")
+	poll(ctx, owner, "licenses", args, func(ctx context.Context) error {
+		var p enterpriseBillingInfo
+		if err := fetchGraphQL(ctx, client, args, enterpriseBillingInfoQuery, variables, &p); err != nil {
+			return err
+		}
+
+		enterpriseLicensesGauge.WithLabelValues(owner).Set(float64(p.Enterprise.BillingInfo.TotalLicenses))
+		enterpriseAvailableLicensesGauge.WithLabelValues(owner).Set(float64(p.Enterprise.BillingInfo.TotalAvailableLicenses))
+		enterpriseLicensableUsersGauge.WithLabelValues(owner).Set(float64(p.Enterprise.BillingInfo.AllLicensableUsersCount))
+
+		return nil
+	})
+}
+
+// getGitHubLFSBilling collects the Git LFS usage of an enterprise, which
+// GitHub reports in GB, converted here at 1024^3 bytes per GB.
+func getGitHubLFSBilling(ctx context.Context, client *http.Client, args *Args) {
+	owner := args.label(account{mode: enterpriseMode, name: args.GraphQLEnterprise})
+	variables := map[string]interface{}{"slug": args.GraphQLEnterprise}
+
+	poll(ctx, owner, "lfs", args, func(ctx context.Context) error {
+		var p lfsBillingInfo
+		if err := fetchGraphQL(ctx, client, args, lfsBillingInfoQuery, variables, &p); err != nil {
+			return err
+		}
+		if p.Enterprise.BillingInfo == nil {
+			return xerrors.Errorf("no git lfs billing: %w", errEmptyBody)
+		}
+
+		lfsBandwidthUsedBytesGauge.WithLabelValues(owner).Set(p.Enterprise.BillingInfo.BandwidthUsage * (1 << 30))
+		lfsStorageUsedBytesGauge.WithLabelValues(owner).Set(p.Enterprise.BillingInfo.StorageUsage * (1 << 30))
+
+		return nil
+	})
+}
+
+// getGitHubCopilotSeats collects the Copilot seats of an organization by its
+// plan type, business or enterprise.
+func getGitHubCopilotSeats(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := fmt.Sprintf("/orgs/%s/copilot/billing", url.PathEscape(o.name)), args.label(o)
+
+	poll(ctx, owner, "copilot", args, func(ctx context.Context) error {
+		var p copilotBilling
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			if xerrors.Is(err, errNotFound) {
+				return skipped(err, "no Copilot subscription")
+			}
+			if xerrors.Is(err, errForbidden) {
+				return skipped(err, "no access to the Copilot billing")
+			}
+			return err
+		}
+		if p.SeatBreakdown == nil {
+			return xerrors.Errorf("no copilot seat breakdown: %w", errEmptyBody)
+		}
+
+		planType := p.PlanType
+		if planType == "" {
+			planType = "unknown"
+		}
+		copilotSeatsGauge.DeletePartialMatch(prometheus.Labels{"owner": owner})
+		copilotSeatsGauge.WithLabelValues(owner, planType).Set(float64(p.SeatBreakdown.Total))
+
+		return nil
+	})
+}
+
+// billingInfoRefresh is how often the billing contact of an organization is
+// requested, it rarely changes.
+const billingInfoRefresh = 24 * time.Hour
+
+func getGitHubBillingInfo(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := fmt.Sprintf("/orgs/%s", url.PathEscape(o.name)), args.label(o)
+
+	var fetched time.Time
+	poll(ctx, owner, "billing_info", args, func(ctx context.Context) error {
+		if !fetched.IsZero() && time.Since(fetched) < billingInfoRefresh {
+			return nil
+		}
+
+		var p organization
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			if xerrors.Is(err, errForbidden) || xerrors.Is(err, errNotFound) {
+				fetched = time.Now()
+				return skipped(err, "no access to the billing contact")
+			}
+			return err
+		}
+		fetched = time.Now()
+
+		orgBillingInfoGauge.DeletePartialMatch(prometheus.Labels{"owner": owner})
+		if p.BillingEmail == "" {
+			return xerrors.Errorf("no billing email, the token isn't an organization owner's: %w", errEmptyBody)
+		}
+		orgBillingInfoGauge.WithLabelValues(owner, p.BillingEmail).Set(1)
+
+		return nil
+	})
+}
+
+// getGitHubSpendingLimit collects the budgets of an owner on the enhanced
+// billing platform, only those preventing further usage are spending limits.
+func getGitHubSpendingLimit(ctx context.Context, client *http.Client, o account, args *Args) {
+	path, owner := budgetsPath(o), args.label(o)
+
+	poll(ctx, owner, "budgets", args, func(ctx context.Context) error {
+		var p budgets
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			if xerrors.Is(err, errNotFound) {
+				return skipped(err, "budgets require the enhanced billing platform")
+			}
+			if xerrors.Is(err, errForbidden) {
+				return skipped(err, "no access to the budgets")
+			}
+			return err
+		}
+
+		var limit float64
+		enabled := false
+		for _, b := range p.Budgets {
+			if b.PreventFurtherUsage {
+				limit += b.BudgetAmount
+				enabled = true
+			}
+		}
+		spendingLimitUSDGauge.WithLabelValues(owner).Set(limit)
+		spendingLimitEnabledGauge.WithLabelValues(owner).Set(boolToFloat(enabled))
+
+		return nil
+	})
+}
+
+// escapeRepository escapes the owner and name of an owner/name repository
+// separately, keeping the slash between them.
+func escapeRepository(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
 	}
 
-	for {
-		var p sharedStorageBilling
-		req, err := http.NewRequest("GET", baseURL, nil)
-		if err != nil {
-			log.Fatal(err)
+	return strings.Join(parts, "/")
+}
+
+func getGitHubActionsCacheUsage(ctx context.Context, client *http.Client, repository string, args *Args) {
+	path := fmt.Sprintf("/repos/%s/actions/cache/usage", escapeRepository(repository))
+
+	poll(ctx, repository, "cache", args, func(ctx context.Context) error {
+		var p actionsCacheUsage
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			return err
 		}
-		req.Header.Set("Authorization", fmt.Sprintf("token %s", args.Token))
 
-		resp, err := client.Do(req)
+		actionsCacheUsageBytesGauge.WithLabelValues(repository).Set(float64(p.ActiveCachesSizeInBytes))
+		actionsCacheCountGauge.WithLabelValues(repository).Set(float64(p.ActiveCachesCount))
+
+		return nil
+	})
+}
+
+func getGitHubCostCenterBilling(ctx context.Context, client *http.Client, args *Args) {
+	enterprise, owner := args.CostCenterEnterprise, args.label(account{mode: enterpriseMode, name: args.CostCenterEnterprise})
+
+	poll(ctx, owner, "cost_centers", args, func(ctx context.Context) error {
+		costCenters, err := fetchCostCenters(ctx, client, enterprise, args)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		err = json.NewDecoder(resp.Body).Decode(&p)
-		if err != nil {
-			log.Fatal(err)
+		type quantityKey struct{ org, costCenter, product, unitType string }
+		netAmounts := make(map[[2]string]float64)
+		quantities := make(map[quantityKey]float64)
+		itemCounts := make(map[string]int)
+		for _, c := range costCenters {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			items, err := fetchUsageItems(ctx, client, enterpriseUsagePath(enterprise, time.Now(), c.ID), args)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range items {
+				org := args.label(account{mode: orgMode, name: item.OrganizationName})
+				netAmounts[[2]string{org, c.Name}] += item.NetAmount
+				quantities[quantityKey{org, c.Name, item.Product, item.UnitType}] += item.Quantity
+				itemCounts[org]++
+			}
 		}
-		resp.Body.Close()
 
-		daysLeftInBillingCycleGauge.WithLabelValues(owner).Set(float64(p.DaysLeftInBillingCycle))
-		estimatedPaidStorageForMonthGauge.WithLabelValues(owner).Set(float64(p.EstimatedPaidStorageForMonth))
-		estimatedStorageForMonthGauge.WithLabelValues(owner).Set(float64(p.EstimatedStorageForMonth))
+		costCenterNetAmountGauge.Reset()
+		for k, v := range netAmounts {
+			costCenterNetAmountGauge.WithLabelValues(k[0], k[1]).Set(v)
+		}
+		costCenterQuantityGauge.Reset()
+		for k, v := range quantities {
+			costCenterQuantityGauge.WithLabelValues(k.org, k.costCenter, k.product, k.unitType).Set(v)
+		}
+		usageItemsGauge.Reset()
+		for org, n := range itemCounts {
+			usageItemsGauge.WithLabelValues(org).Set(float64(n))
+		}
 
-		time.Sleep(time.Duration(args.Refresh) * time.Second)
-	}
+		return nil
+	})
 }
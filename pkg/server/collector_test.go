@@ -0,0 +1,344 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gaugeValue returns the value of the gauge with the label values, or
+// fails the test if it isn't exported.
+func gaugeValue(t *testing.T, g *prometheus.GaugeVec, labels ...string) float64 {
+	t.Helper()
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		g.Collect(metrics)
+		close(metrics)
+	}()
+
+	want := strings.Join(sortedCopy(labels), "\x00")
+	value, found := 0.0, false
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for _, l := range pb.Label {
+			values = append(values, l.GetValue())
+		}
+		if strings.Join(sortedCopy(values), "\x00") == want {
+			value, found = pb.GetGauge().GetValue(), true
+		}
+	}
+	if !found {
+		t.Fatalf("no gauge with the labels %v", labels)
+	}
+
+	return value
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string(nil), s...)
+	sort.Strings(c)
+	return c
+}
+
+type gaugeWant struct {
+	name   string
+	gauge  *prometheus.GaugeVec
+	labels []string
+	value  float64
+}
+
+func checkGauges(t *testing.T, wants []gaugeWant) {
+	t.Helper()
+
+	for _, w := range wants {
+		if got := gaugeValue(t, w.gauge, w.labels...); got != w.value {
+			t.Errorf("%s%v = %v, want %v", w.name, w.labels, got, w.value)
+		}
+	}
+}
+
+func TestSetActionsBilling(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want func(owner string) []gaugeWant
+	}{
+		{
+			name: "paid minutes as 0.0",
+			body: `{"total_minutes_used":120,"total_paid_minutes_used":"0.0","included_minutes":2000,"minutes_used_breakdown":{"UBUNTU":100,"MACOS":10,"WINDOWS":10}}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"actions_total_minutes_used", totalMinutesUsedGauge, []string{owner}, 120},
+					{"actions_total_paid_minutes_used", totalPaidMinutesUsedGauge, []string{owner}, 0},
+					{"actions_included_minutes", includedMinutesGauge, []string{owner}, 2000},
+					{"actions_free_minutes_used", freeMinutesUsedGauge, []string{owner}, 120},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "macos"}, 10},
+				}
+			},
+		},
+		{
+			name: "missing breakdown keys",
+			body: `{"total_minutes_used":50,"total_paid_minutes_used":"5","included_minutes":2000,"minutes_used_breakdown":{"UBUNTU":50}}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"actions_total_paid_minutes_used", totalPaidMinutesUsedGauge, []string{owner}, 5},
+					{"actions_free_minutes_used", freeMinutesUsedGauge, []string{owner}, 45},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "ubuntu"}, 50},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "macos"}, 0},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "windows"}, 0},
+				}
+			},
+		},
+		{
+			name: "unknown keys",
+			body: `{"total_minutes_used":30,"total_paid_minutes_used":"0","included_minutes":3000,"minutes_used_breakdown":{"UBUNTU":30},"total_minutes_used_by_runner":{"x":1},"plan":"team"}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"actions_total_minutes_used", totalMinutesUsedGauge, []string{owner}, 30},
+					{"actions_included_minutes", includedMinutesGauge, []string{owner}, 3000},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "ubuntu"}, 30},
+				}
+			},
+		},
+		{
+			name: "null fields",
+			body: `{"total_minutes_used":10,"total_paid_minutes_used":null,"included_minutes":null,"minutes_used_breakdown":null}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"actions_total_minutes_used", totalMinutesUsedGauge, []string{owner}, 10},
+					{"actions_total_paid_minutes_used", totalPaidMinutesUsedGauge, []string{owner}, 0},
+					// A null included_minutes is an unlimited plan.
+					{"actions_plan_unlimited", actionsPlanUnlimitedGauge, []string{owner}, 1},
+					{"actions_minutes_used_breakdown", minutesUsedBreakdownGauge, []string{owner, "ubuntu"}, 0},
+					{"actions_self_hosted_minutes", actionsSelfHostedMinutesGauge, []string{owner}, 10},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := "actions " + tt.name
+			args := &Args{}
+
+			var p actionsBilling
+			if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			p.unlimited = includedMinutesUnlimited(json.RawMessage(tt.body), &p, args)
+			if err := setActionsBilling(owner, &p, args); err != nil {
+				t.Fatalf("setActionsBilling: %v", err)
+			}
+			checkGauges(t, tt.want(owner))
+		})
+	}
+}
+
+func TestSetPackagesBilling(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want func(owner string) []gaugeWant
+	}{
+		{
+			name: "all fields",
+			body: `{"total_gigabytes_bandwidth_used":50,"total_paid_gigabytes_bandwidth_used":40,"included_gigabytes_bandwidth":10}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"packages_total_gigabytes_bandwidth_used", totalGigabytesBandwidthUsedGauge, []string{owner}, 50},
+					{"packages_total_paid_gigabytes_bandwidth_used", totalPaidGigabytesBandwidthUsedGauge, []string{owner}, 40},
+					{"packages_included_gigabytes_bandwidth", includedGigabytesBandwidthGauge, []string{owner}, 10},
+					{"packages_paid_bandwidth_ratio", packagesPaidBandwidthRatioGauge, []string{owner}, 4},
+				}
+			},
+		},
+		{
+			name: "missing keys",
+			body: `{"total_gigabytes_bandwidth_used":5}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"packages_total_gigabytes_bandwidth_used", totalGigabytesBandwidthUsedGauge, []string{owner}, 5},
+					{"packages_total_paid_gigabytes_bandwidth_used", totalPaidGigabytesBandwidthUsedGauge, []string{owner}, 0},
+					{"packages_paid_bandwidth_ratio", packagesPaidBandwidthRatioGauge, []string{owner}, 0},
+				}
+			},
+		},
+		{
+			name: "unknown keys",
+			body: `{"total_gigabytes_bandwidth_used":3,"total_paid_gigabytes_bandwidth_used":0,"included_gigabytes_bandwidth":10,"storage":{"gb":1}}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"packages_total_gigabytes_bandwidth_used", totalGigabytesBandwidthUsedGauge, []string{owner}, 3},
+					{"packages_included_gigabytes_bandwidth", includedGigabytesBandwidthGauge, []string{owner}, 10},
+					{"packages_paid_usage_active", packagesPaidUsageActiveGauge, []string{owner}, 0},
+				}
+			},
+		},
+		{
+			name: "null fields",
+			body: `{"total_gigabytes_bandwidth_used":null,"total_paid_gigabytes_bandwidth_used":null,"included_gigabytes_bandwidth":1}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"packages_total_gigabytes_bandwidth_used", totalGigabytesBandwidthUsedGauge, []string{owner}, 0},
+					{"packages_total_paid_gigabytes_bandwidth_used", totalPaidGigabytesBandwidthUsedGauge, []string{owner}, 0},
+					{"packages_included_gigabytes_bandwidth", includedGigabytesBandwidthGauge, []string{owner}, 1},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := "packages " + tt.name
+
+			var p packagesBilling
+			if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			setPackagesBilling(owner, &p, &Args{})
+			checkGauges(t, tt.want(owner))
+		})
+	}
+}
+
+func TestSetSharedStorageBilling(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want func(owner string) []gaugeWant
+	}{
+		{
+			name: "all fields",
+			body: `{"days_left_in_billing_cycle":20,"estimated_paid_storage_for_month":15,"estimated_storage_for_month":40}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"shared_storage_days_left_in_billing_cycle", daysLeftInBillingCycleGauge, []string{owner}, 20},
+					{"shared_storage_estimated_paid_storage_for_month", estimatedPaidStorageForMonthGauge, []string{owner}, 15},
+					{"shared_storage_estimated_storage_for_month", estimatedStorageForMonthGauge, []string{owner}, 40},
+					{"shared_storage_free_estimate", sharedStorageFreeEstimateGauge, []string{owner}, 25},
+				}
+			},
+		},
+		{
+			name: "missing keys",
+			body: `{"estimated_storage_for_month":10}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"shared_storage_days_left_in_billing_cycle", daysLeftInBillingCycleGauge, []string{owner}, 0},
+					{"shared_storage_estimated_paid_storage_for_month", estimatedPaidStorageForMonthGauge, []string{owner}, 0},
+					{"shared_storage_free_estimate", sharedStorageFreeEstimateGauge, []string{owner}, 10},
+				}
+			},
+		},
+		{
+			name: "unknown keys",
+			body: `{"days_left_in_billing_cycle":3,"estimated_paid_storage_for_month":0,"estimated_storage_for_month":2,"estimated_storage_for_next_month":9}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"shared_storage_days_left_in_billing_cycle", daysLeftInBillingCycleGauge, []string{owner}, 3},
+					{"shared_storage_estimated_storage_for_month", estimatedStorageForMonthGauge, []string{owner}, 2},
+				}
+			},
+		},
+		{
+			name: "null fields",
+			body: `{"days_left_in_billing_cycle":null,"estimated_paid_storage_for_month":null,"estimated_storage_for_month":null}`,
+			want: func(owner string) []gaugeWant {
+				return []gaugeWant{
+					{"shared_storage_days_left_in_billing_cycle", daysLeftInBillingCycleGauge, []string{owner}, 0},
+					{"shared_storage_estimated_storage_for_month", estimatedStorageForMonthGauge, []string{owner}, 0},
+					{"shared_storage_free_estimate", sharedStorageFreeEstimateGauge, []string{owner}, 0},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := "shared storage " + tt.name
+
+			var p sharedStorageBilling
+			if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			setSharedStorageBilling(owner, &p, &Args{})
+			checkGauges(t, tt.want(owner))
+		})
+	}
+}
+
+func TestParsePaidMinutes(t *testing.T) {
+	tests := []struct {
+		s                string
+		decimalSeparator string
+		want             float64
+		wantErr          bool
+	}{
+		{s: "", want: 0},
+		{s: "0", want: 0},
+		{s: "0.00", want: 0},
+		{s: "1234.5", want: 1234.5},
+		{s: "1.234,50 USD", wantErr: true},
+		{s: "1.234,50 USD", decimalSeparator: ",", want: 1234.5},
+		{s: "$1,234.50", decimalSeparator: ".", want: 1234.5},
+		{s: "n/a", wantErr: true},
+		{s: "n/a", decimalSeparator: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePaidMinutes(tt.s, tt.decimalSeparator)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePaidMinutes(%q, %q) error = %v, want error %v", tt.s, tt.decimalSeparator, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePaidMinutes(%q, %q) = %v, want %v", tt.s, tt.decimalSeparator, got, tt.want)
+		}
+	}
+}
+
+func TestSetActionsBillingMalformedPaidMinutes(t *testing.T) {
+	p := &actionsBilling{TotalMinutesUsed: 10, TotalPaidMinutesUsed: "n/a", IncludedMinutes: 2000}
+	if err := setActionsBilling("malformed paid minutes", p, &Args{}); err == nil {
+		t.Fatal("setActionsBilling accepted total_paid_minutes_used of n/a")
+	}
+}
+
+func TestBillingPathEscapesSlug(t *testing.T) {
+	tests := []struct {
+		o    account
+		want string
+	}{
+		{account{mode: orgMode, name: "acme"}, "/orgs/acme/settings/billing/actions"},
+		{account{mode: orgMode, name: "acme corp"}, "/orgs/acme%20corp/settings/billing/actions"},
+		{account{mode: userMode, name: "octo/cat"}, "/users/octo%2Fcat/settings/billing/actions"},
+		{account{mode: enterpriseMode, name: "ünï?co#de"}, "/enterprises/%C3%BCn%C3%AF%3Fco%23de/settings/billing/actions"},
+	}
+	for _, tt := range tests {
+		if got := billingPath(tt.o, "actions"); got != tt.want {
+			t.Errorf("billingPath(%q) = %q, want %q", tt.o.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		want       string
+	}{
+		{"acme/app", "acme/app"},
+		{"acme/my app", "acme/my%20app"},
+		{"acme corp/app?v=2", "acme%20corp/app%3Fv=2"},
+		{"acme/app/extra", "acme/app%2Fextra"},
+	}
+	for _, tt := range tests {
+		if got := escapeRepository(tt.repository); got != tt.want {
+			t.Errorf("escapeRepository(%q) = %q, want %q", tt.repository, got, tt.want)
+		}
+	}
+}
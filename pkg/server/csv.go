@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var csvHeader = []string{"timestamp", "owner", "endpoint", "field", "value"}
+
+var csvMu sync.Mutex
+
+// csvPath inserts the date into the configured file name, e.g. billing.csv
+// becomes billing-2006-01-02.csv, so a new file is started every day.
+func csvPath(base string, t time.Time) string {
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(base, ext), t.Format("2006-01-02"), ext)
+}
+
+// appendCSV appends a row per field of a billing response, nested objects such
+// as minutes_used_breakdown are flattened to minutes_used_breakdown.UBUNTU.
+func appendCSV(args *Args, owner, endpoint string, v interface{}) {
+	now := time.Now().UTC()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to write %s billing for %s to CSV: %v\n", endpoint, owner, err)
+		return
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		log.Printf("Failed to write %s billing for %s to CSV: %v\n", endpoint, owner, err)
+		return
+	}
+	fields := make(map[string]string)
+	flattenCSVFields("", m, fields)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	csvMu.Lock()
+	defer csvMu.Unlock()
+
+	path := csvPath(args.CSVOutput, now)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("Failed to write %s billing for %s to CSV: %v\n", endpoint, owner, err)
+		return
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		w.Write(csvHeader)
+	}
+	timestamp := now.Format(time.RFC3339)
+	for _, name := range names {
+		w.Write([]string{timestamp, owner, endpoint, name, fields[name]})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		log.Printf("Failed to write %s billing for %s to %s: %v\n", endpoint, owner, path, err)
+	}
+}
+
+func flattenCSVFields(prefix string, m map[string]interface{}, fields map[string]string) {
+	for k, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenCSVFields(prefix+k+".", nested, fields)
+			continue
+		}
+		if v == nil {
+			v = ""
+		}
+		fields[prefix+k] = fmt.Sprint(v)
+	}
+}
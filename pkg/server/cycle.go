@@ -0,0 +1,121 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxDaysUntilExhaustion caps the projection of accounts which barely use any
+// minutes, as simple division would report thousands of days.
+const maxDaysUntilExhaustion = 365
+
+// billingCycles remembers days_left_in_billing_cycle per owner. Only the
+// shared storage endpoint reports it, but the Actions projections need it.
+// A rollover is days_left jumping back up, when a new cycle started.
+var billingCycles = struct {
+	sync.Mutex
+	daysLeft   map[string]int
+	rolledOver map[string]time.Time
+}{daysLeft: make(map[string]int), rolledOver: make(map[string]time.Time)}
+
+func setDaysLeftInBillingCycle(owner string, days int, now time.Time) {
+	billingCycles.Lock()
+	defer billingCycles.Unlock()
+
+	if previous, ok := billingCycles.daysLeft[owner]; ok && days > previous {
+		billingCycles.rolledOver[owner] = now
+	}
+	billingCycles.daysLeft[owner] = days
+}
+
+// holdBilling reports whether the billing values of an owner are held, i.e.
+// not updated, as the cycle rolled over less than args.RolloverGracePeriod
+// ago. GitHub lags real usage by hours and may briefly report zeroes for
+// the new cycle, which would fire alerts spuriously.
+func holdBilling(owner string, args *Args, now time.Time) bool {
+	if args.RolloverGracePeriod <= 0 {
+		return false
+	}
+
+	billingCycles.Lock()
+	rolledOver, ok := billingCycles.rolledOver[owner]
+	billingCycles.Unlock()
+
+	hold := ok && now.Sub(rolledOver) < args.RolloverGracePeriod
+	inGracePeriodGauge.WithLabelValues(owner).Set(boolToFloat(hold))
+
+	return hold
+}
+
+// daysElapsedInBillingCycle estimates the days since the cycle started, taking
+// the cycle to be as long as the current calendar month. It is false until the
+// shared storage billing of the owner has been collected.
+func daysElapsedInBillingCycle(owner string, now time.Time) (float64, bool) {
+	billingCycles.Lock()
+	daysLeft, ok := billingCycles.daysLeft[owner]
+	billingCycles.Unlock()
+	if !ok {
+		return 0, false
+	}
+
+	cycleDays := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()).Day()
+	return math.Max(float64(cycleDays-daysLeft), 1), true
+}
+
+// secondsElapsedInBillingCycle refines daysElapsedInBillingCycle by the time
+// since midnight UTC, taking the cycle to have started at midnight.
+func secondsElapsedInBillingCycle(owner string, now time.Time) (float64, bool) {
+	billingCycles.Lock()
+	daysLeft, ok := billingCycles.daysLeft[owner]
+	billingCycles.Unlock()
+	if !ok {
+		return 0, false
+	}
+
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	cycleDays := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	start := midnight.AddDate(0, 0, -int(math.Max(float64(cycleDays-daysLeft), 0)))
+
+	return now.Sub(start).Seconds(), true
+}
+
+// daysUntilExhaustion projects when the included minutes run out at the burn
+// rate so far this cycle.
+func daysUntilExhaustion(used, included, daysElapsed float64) float64 {
+	remaining := included - used
+	if remaining <= 0 {
+		return 0
+	}
+	if used <= 0 {
+		return maxDaysUntilExhaustion
+	}
+
+	return math.Min(remaining/(used/daysElapsed), maxDaysUntilExhaustion)
+}
+
+// ownerUp remembers the outcome of the last cycle of every endpoint per
+// owner, github_billing_up is 1 only while all of them succeeded.
+var ownerUp = struct {
+	sync.Mutex
+	succeeded map[string]map[string]bool
+}{succeeded: make(map[string]map[string]bool)}
+
+func setOwnerUp(owner, endpoint string, succeeded bool) {
+	ownerUp.Lock()
+	defer ownerUp.Unlock()
+
+	endpoints, ok := ownerUp.succeeded[owner]
+	if !ok {
+		endpoints = make(map[string]bool)
+		ownerUp.succeeded[owner] = endpoints
+	}
+	endpoints[endpoint] = succeeded
+
+	up := true
+	for _, ok := range endpoints {
+		up = up && ok
+	}
+	upGauge.WithLabelValues(owner).Set(boolToFloat(up))
+}
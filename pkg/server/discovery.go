@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// discoverOrganizations lists the organizations the token's user belongs to
+// which it can read the billing of. Organizations answering 403 or 404, i.e.
+// without admin or billing manager access, are skipped.
+func discoverOrganizations(ctx context.Context, client *http.Client, args *Args) ([]string, error) {
+	var logins []string
+	for page := 1; ; page++ {
+		var p []struct {
+			Login string `json:"login"`
+		}
+		path := fmt.Sprintf("/user/orgs?per_page=100&page=%d", page)
+		if err := fetch(ctx, client, path, args, &p); err != nil && !xerrors.Is(err, errEmptyBody) {
+			return nil, xerrors.Errorf("listing the organizations of the user: %w", err)
+		}
+
+		for _, o := range p {
+			logins = append(logins, o.Login)
+		}
+		if len(p) < 100 {
+			break
+		}
+	}
+
+	var organizations []string
+	skipped := map[string]int{"forbidden": 0, "not_found": 0}
+	for _, login := range logins {
+		var p actionsBilling
+		err := fetch(ctx, client, billingPath(account{mode: orgMode, name: login}, "actions"), args, &p)
+		if xerrors.Is(err, errForbidden) || xerrors.Is(err, errNotFound) {
+			log.Printf("Skipped organization %s: no access to its billing\n", login)
+			if xerrors.Is(err, errForbidden) {
+				skipped["forbidden"]++
+			} else {
+				skipped["not_found"]++
+			}
+			continue
+		}
+		organizations = append(organizations, login)
+	}
+
+	discoveredOwnersTotalGauge.Set(float64(len(organizations)))
+	for reason, n := range skipped {
+		skippedOwnersTotalGauge.WithLabelValues(reason).Set(float64(n))
+	}
+
+	return organizations, nil
+}
+
+// addOrganizations appends the organizations which aren't configured yet.
+func addOrganizations(configured, discovered []string) []string {
+	seen := make(map[string]bool, len(configured))
+	for _, o := range configured {
+		seen[strings.ToLower(o)] = true
+	}
+
+	for _, o := range discovered {
+		if !seen[strings.ToLower(o)] {
+			seen[strings.ToLower(o)] = true
+			configured = append(configured, o)
+		}
+	}
+
+	return configured
+}
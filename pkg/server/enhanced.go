@@ -0,0 +1,267 @@
+// https://docs.github.com/en/rest/billing/enhanced-billing
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/xerrors"
+)
+
+type costCenters struct {
+	CostCenters []costCenter `json:"costCenters"`
+}
+
+type costCenter struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type usageReport struct {
+	UsageItems []usageItem `json:"usageItems"`
+}
+
+type usageItem struct {
+	Date             string  `json:"date"`
+	Product          string  `json:"product"`
+	SKU              string  `json:"sku"`
+	Quantity         float64 `json:"quantity"`
+	UnitType         string  `json:"unitType"`
+	PricePerUnit     float64 `json:"pricePerUnit"`
+	GrossAmount      float64 `json:"grossAmount"`
+	DiscountAmount   float64 `json:"discountAmount"`
+	NetAmount        float64 `json:"netAmount"`
+	OrganizationName string  `json:"organizationName"`
+	RepositoryName   string  `json:"repositoryName"`
+}
+
+type budgets struct {
+	Budgets []budget `json:"budgets"`
+}
+
+type budget struct {
+	BudgetAmount float64 `json:"budget_amount"`
+	// PreventFurtherUsage makes the budget a hard spending limit rather
+	// than only alerting on it.
+	PreventFurtherUsage bool `json:"prevent_further_usage"`
+}
+
+// enterpriseUsagePath returns the usage report of the month containing t,
+// limited to a cost center unless costCenterID is empty.
+func enterpriseUsagePath(enterprise string, t time.Time, costCenterID string) string {
+	q := url.Values{}
+	q.Set("year", fmt.Sprint(t.UTC().Year()))
+	q.Set("month", fmt.Sprint(int(t.UTC().Month())))
+	if costCenterID != "" {
+		q.Set("cost_center_id", costCenterID)
+	}
+
+	return fmt.Sprintf("/enterprises/%s/settings/billing/usage?%s", url.PathEscape(enterprise), q.Encode())
+}
+
+// ownerUsagePath returns the usage report of the month containing t for an
+// owner on the enhanced billing platform.
+func ownerUsagePath(o account, t time.Time) string {
+	q := url.Values{}
+	q.Set("year", fmt.Sprint(t.UTC().Year()))
+	q.Set("month", fmt.Sprint(int(t.UTC().Month())))
+
+	switch o.mode {
+	case orgMode:
+		return fmt.Sprintf("/organizations/%s/settings/billing/usage?%s", url.PathEscape(o.name), q.Encode())
+	case userMode:
+		return fmt.Sprintf("/users/%s/settings/billing/usage?%s", url.PathEscape(o.name), q.Encode())
+	default:
+		return fmt.Sprintf("/enterprises/%s/settings/billing/usage?%s", url.PathEscape(o.name), q.Encode())
+	}
+}
+
+// budgetsPath returns the budgets of an organization or enterprise, users
+// have none.
+func budgetsPath(o account) string {
+	if o.mode == orgMode {
+		return fmt.Sprintf("/organizations/%s/settings/billing/budgets", url.PathEscape(o.name))
+	}
+
+	return fmt.Sprintf("/enterprises/%s/settings/billing/budgets", url.PathEscape(o.name))
+}
+
+// isEnhancedBilling reports whether a classic billing endpoint rejected the
+// request because the owner moved to the enhanced billing platform.
+func isEnhancedBilling(err error) bool {
+	var statusErr *statusError
+	return xerrors.As(err, &statusErr) && statusErr.code == http.StatusGone
+}
+
+func setBillingPlatform(owner, platform string) {
+	for _, p := range []string{"classic", "enhanced"} {
+		if p != platform {
+			billingPlatformGauge.DeleteLabelValues(owner, p)
+		}
+	}
+	billingPlatformGauge.WithLabelValues(owner, platform).Set(1)
+}
+
+// actionsBillingFromUsage maps the Actions minutes of a usage report onto
+// the classic response. The report has no included minutes, so minutes
+// which were charged for are counted as paid.
+func actionsBillingFromUsage(items []usageItem) *actionsBilling {
+	p := &actionsBilling{MinutesUsedBreakdown: make(map[string]int)}
+
+	var paid float64
+	for _, item := range items {
+		if !strings.EqualFold(item.Product, "actions") || !strings.EqualFold(item.UnitType, "minutes") {
+			continue
+		}
+
+		minutes := int(math.Round(item.Quantity))
+		p.TotalMinutesUsed += minutes
+		if item.NetAmount > 0 {
+			paid += item.Quantity
+		}
+
+		sku := strings.ToLower(item.SKU)
+		switch {
+		case strings.Contains(sku, "linux"):
+			p.MinutesUsedBreakdown["ubuntu"] += minutes
+		case strings.Contains(sku, "macos"):
+			p.MinutesUsedBreakdown["macos"] += minutes
+		case strings.Contains(sku, "windows"):
+			p.MinutesUsedBreakdown["windows"] += minutes
+		}
+	}
+	p.TotalPaidMinutesUsed = strconv.FormatFloat(paid, 'f', -1, 64)
+
+	return p
+}
+
+// maxUsageHistoryMonths bounds --usage-history-months, GitHub keeps the
+// usage reports of the last 24 months.
+const maxUsageHistoryMonths = 24
+
+// monthlyUsage sums the usage items of a month per product.
+type monthlyUsage struct {
+	netAmounts map[string]float64
+	quantities map[[2]string]float64
+}
+
+func newMonthlyUsage(items []usageItem) *monthlyUsage {
+	u := &monthlyUsage{netAmounts: make(map[string]float64), quantities: make(map[[2]string]float64)}
+	for _, item := range items {
+		product := strings.ToLower(item.Product)
+		u.netAmounts[product] += item.NetAmount
+		u.quantities[[2]string{product, item.UnitType}] += item.Quantity
+	}
+
+	return u
+}
+
+// closedMonths caches the usage of previous months per owner, closed months
+// don't change and are only requested once.
+var closedMonths = struct {
+	sync.Mutex
+	m map[string]map[string]*monthlyUsage
+}{m: make(map[string]map[string]*monthlyUsage)}
+
+// setMonthlyUsage exports the usage of the current month, taken from the
+// report the Actions collector requested anyway, and of the previous
+// args.UsageHistoryMonths months. At most one uncached month is requested
+// per cycle so a long history doesn't exhaust the rate limit at startup.
+func setMonthlyUsage(ctx context.Context, client *http.Client, o account, owner string, items []usageItem, args *Args) {
+	now := time.Now().UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	setMonthUsage(owner, current.Format("2006-01"), newMonthlyUsage(items))
+
+	closedMonths.Lock()
+	cached, ok := closedMonths.m[owner]
+	if !ok {
+		cached = make(map[string]*monthlyUsage)
+		closedMonths.m[owner] = cached
+	}
+	closedMonths.Unlock()
+
+	wanted := make(map[string]bool, args.UsageHistoryMonths)
+	fetched := false
+	for i := 1; i <= args.UsageHistoryMonths; i++ {
+		t := current.AddDate(0, -i, 0)
+		month := t.Format("2006-01")
+		wanted[month] = true
+
+		closedMonths.Lock()
+		u, ok := cached[month]
+		closedMonths.Unlock()
+		if !ok {
+			if fetched {
+				continue
+			}
+			fetched = true
+
+			monthItems, err := fetchUsageItems(ctx, client, ownerUsagePath(o, t), args)
+			if err != nil {
+				logf(ctx, "Failed to collect the %s usage: %v\n", month, err)
+				continue
+			}
+			u = newMonthlyUsage(monthItems)
+
+			closedMonths.Lock()
+			cached[month] = u
+			closedMonths.Unlock()
+		}
+		setMonthUsage(owner, month, u)
+	}
+
+	// Months which fell out of the history, e.g. at the turn of a month.
+	closedMonths.Lock()
+	defer closedMonths.Unlock()
+	for month := range cached {
+		if !wanted[month] {
+			delete(cached, month)
+			usageNetAmountGauge.DeletePartialMatch(prometheus.Labels{"owner": owner, "month": month})
+			usageQuantityGauge.DeletePartialMatch(prometheus.Labels{"owner": owner, "month": month})
+		}
+	}
+}
+
+func setMonthUsage(owner, month string, u *monthlyUsage) {
+	for product, amount := range u.netAmounts {
+		usageNetAmountGauge.WithLabelValues(owner, month, product).Set(amount)
+	}
+	for k, quantity := range u.quantities {
+		usageQuantityGauge.WithLabelValues(owner, month, k[0], k[1]).Set(quantity)
+	}
+}
+
+func fetchCostCenters(ctx context.Context, client *http.Client, enterprise string, args *Args) ([]costCenter, error) {
+	var p costCenters
+	if err := fetch(ctx, client, fmt.Sprintf("/enterprises/%s/settings/billing/cost-centers", url.PathEscape(enterprise)), args, &p); err != nil {
+		return nil, err
+	}
+
+	return p.CostCenters, nil
+}
+
+func fetchUsageItems(ctx context.Context, client *http.Client, path string, args *Args) ([]usageItem, error) {
+	if args.UsageFormat == "csv" {
+		var p usageCSV
+		if err := fetchAs(ctx, client, path, "text/csv", args, &p); err != nil {
+			return nil, err
+		}
+
+		return p.UsageItems, nil
+	}
+
+	var p usageReport
+	if err := fetch(ctx, client, path, args, &p); err != nil {
+		return nil, err
+	}
+
+	return p.UsageItems, nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Status errors can be told apart with xerrors.Is, e.g.
+// xerrors.Is(err, errNotFound), and rate limits with xerrors.As.
+var (
+	errUnauthorized = xerrors.New("unauthorized")
+	errForbidden    = xerrors.New("forbidden")
+	errNotFound     = xerrors.New("not found")
+	errServer       = xerrors.New("server error")
+)
+
+// statusError is returned for a response other than 200 OK.
+type statusError struct {
+	method string
+	url    string
+	status string
+	code   int
+	// ssoURL is where the token has to be authorized for an organization
+	// enforcing SAML single sign-on.
+	ssoURL string
+}
+
+func (e *statusError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.method, e.url, e.status)
+	switch e.code {
+	case http.StatusUnauthorized:
+		msg += ", the token is invalid or expired"
+	case http.StatusForbidden:
+		if e.ssoURL != "" {
+			msg += ", the token has to be authorized for SAML single sign-on at " + e.ssoURL
+		} else if isUserBillingURL(e.url) {
+			msg += ", the billing of a user can only be read with a token of that user"
+		} else {
+			msg += ", the token lacks the required scope or access"
+		}
+	case http.StatusNotFound:
+		msg += ", it doesn't exist or the token can't access it"
+	}
+
+	return msg
+}
+
+// isUserBillingURL reports whether u is the billing of a user, e.g.
+// /users/octocat/settings/billing/actions.
+func isUserBillingURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(parsed.Path, "/users/") && strings.Contains(parsed.Path, "/settings/billing/")
+}
+
+func (e *statusError) Is(target error) bool {
+	switch target {
+	case errUnauthorized:
+		return e.code == http.StatusUnauthorized
+	case errForbidden:
+		return e.code == http.StatusForbidden
+	case errNotFound:
+		return e.code == http.StatusNotFound
+	case errServer:
+		return e.code >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+// rateLimitedError is returned for a 429, or a 403 with the rate limit
+// exhausted, retryAfter is how long GitHub asks to wait.
+type rateLimitedError struct {
+	*statusError
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("%s %s: %s, rate limit exceeded, retry after %v", e.method, e.url, e.status, e.retryAfter)
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return e.statusError
+}
+
+func newStatusError(req *http.Request, resp *http.Response) error {
+	err := &statusError{
+		method: req.Method,
+		url:    req.URL.String(),
+		status: resp.Status,
+		code:   resp.StatusCode,
+		ssoURL: ssoAuthorizationURL(resp.Header),
+	}
+
+	rateLimited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0")
+	if !rateLimited {
+		return err
+	}
+
+	return &rateLimitedError{statusError: err, retryAfter: retryAfter(resp.Header, time.Now())}
+}
+
+// retryAfter prefers the Retry-After header of secondary rate limits over
+// the reset of the primary one.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if d := time.Unix(reset, 0).Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// skippedError is a status error a collector skips instead of failing, e.g.
+// the 404 of an organization without a Copilot subscription. It matches
+// errEmptyBody while keeping the status error in the chain, so that
+// recordEndpointAccess still sees the 403 or 404.
+type skippedError struct {
+	err    error
+	reason string
+}
+
+func skipped(err error, reason string) error {
+	return &skippedError{err: err, reason: reason}
+}
+
+func (e *skippedError) Error() string {
+	return fmt.Sprintf("%v, %s", e.err, e.reason)
+}
+
+func (e *skippedError) Unwrap() error {
+	return e.err
+}
+
+func (e *skippedError) Is(target error) bool {
+	return target == errEmptyBody
+}
@@ -0,0 +1,67 @@
+// https://docs.github.com/en/graphql
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// graphQLURL derives the GraphQL endpoint from the REST base URL, GitHub
+// Enterprise Server serves it at /api/graphql next to /api/v3.
+func graphQLURL(args *Args) string {
+	base := strings.TrimSuffix(args.BaseURL, "/")
+	if strings.HasSuffix(base, "/api/v3") {
+		return strings.TrimSuffix(base, "/v3") + "/graphql"
+	}
+
+	return base + "/graphql"
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func fetchGraphQL(ctx context.Context, client *http.Client, args *Args, query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	var resp graphQLResponse
+	err = retry(ctx, args, func() error {
+		req, err := newGitHubRequest(ctx, "POST", graphQLURL(args), bytes.NewReader(body), args)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		return do(client, req, args, &resp)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Errors) > 0 {
+		messages := make([]string, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return xerrors.Errorf("graphql: %s", strings.Join(messages, "; "))
+	}
+
+	return json.Unmarshal(resp.Data, v)
+}
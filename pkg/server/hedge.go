@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// hedgeDelay is how long a request waits for its response before a second
+// one is sent, a fraction of the scrape timeout of its owner. Only GET
+// requests are hedged, they have no body to send twice.
+func hedgeDelay(req *http.Request, args *Args) (time.Duration, bool) {
+	if !args.EnableHedging || req.Method != http.MethodGet {
+		return 0, false
+	}
+	owner, _ := ownerFromContext(req.Context())
+
+	return time.Duration(float64(args.scrapeTimeout(owner)) * args.HedgeAfter), true
+}
+
+// hedgedDo sends req, and a copy of it if no response arrived within delay,
+// returning whichever response arrives first. The other request is
+// cancelled, the winner's once its body is closed. A request failing while
+// the other one is still on its way, e.g. on a reset connection, leaves it
+// to answer, only both failing fails. The copy takes a request slot of its
+// own until one of the two is done, it isn't sent while all of them are
+// taken.
+func hedgedDo(client *http.Client, req *http.Request, delay time.Duration) (*http.Response, error) {
+	type result struct {
+		i    int
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := client.Do(req.Clone(ctx))
+			results <- result{i, resp, err}
+		}()
+	}
+
+	send()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var r result
+	releaseHedge := func() {}
+	select {
+	case r = <-results:
+	case <-timer.C:
+		release, ok := tryAcquireRequestSlot()
+		if !ok {
+			r = <-results
+			break
+		}
+		releaseHedge = release
+		hedgedRequestsCounter.Inc()
+		send()
+		r = <-results
+	}
+	pending := len(cancels) - 1
+
+	if r.err != nil && pending > 0 {
+		cancels[r.i]()
+		if other := <-results; other.err == nil {
+			r = other
+		}
+		pending--
+		releaseHedge()
+	}
+
+	for i, cancel := range cancels {
+		if i == r.i {
+			continue
+		}
+		cancel()
+		if pending > 0 {
+			go func() {
+				if loser := <-results; loser.resp != nil {
+					loser.resp.Body.Close()
+				}
+				releaseHedge()
+			}()
+		}
+	}
+
+	if r.err != nil {
+		cancels[r.i]()
+		return nil, r.err
+	}
+	r.resp.Body = cancelOnClose{r.resp.Body, cancels[r.i]}
+
+	return r.resp, nil
+}
+
+// cancelOnClose releases the context of a hedged request with its body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+
+	return err
+}
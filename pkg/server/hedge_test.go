@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func okResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}
+}
+
+// slowFirstTransport answers every request but the first one right away, the
+// first one only once its context is done, which is reported on cancelled.
+func slowFirstTransport(calls *int32, cancelled chan<- struct{}) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(calls, 1) > 1 {
+			return okResponse(req), nil
+		}
+		<-req.Context().Done()
+		close(cancelled)
+		return nil, req.Context().Err()
+	})
+}
+
+func TestHedgedDoCancelsSlowerRequest(t *testing.T) {
+	var calls int32
+	cancelled := make(chan struct{})
+	client := &http.Client{Transport: slowFirstTransport(&calls, cancelled)}
+
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/orgs/acme/settings/billing/actions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hedgedDo(client, req, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("hedgedDo: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the slower request wasn't cancelled")
+	}
+}
+
+func TestHedgedDoTakesARequestSlot(t *testing.T) {
+	defer func() { requestSlots = nil }()
+
+	tests := []struct {
+		name      string
+		slots     int
+		wantCalls int32
+	}{
+		{"slot free", 2, 2},
+		{"every slot taken", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMaxConcurrency(tt.slots)
+			release, err := acquireRequestSlot(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			var calls int32
+			cancelled := make(chan struct{})
+			client := &http.Client{
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt32(&calls, 1) > 1 {
+						if n := len(requestSlots); n != 2 {
+							t.Errorf("%d request slots taken during the hedged request, want 2", n)
+						}
+						return okResponse(req), nil
+					}
+					select {
+					case <-req.Context().Done():
+						close(cancelled)
+						return nil, req.Context().Err()
+					case <-time.After(50 * time.Millisecond):
+						return okResponse(req), nil
+					}
+				}),
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "https://api.github.com/orgs/acme/settings/billing/actions", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := hedgedDo(client, req, 5*time.Millisecond)
+			if err != nil {
+				t.Fatalf("hedgedDo: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", got, tt.wantCalls)
+			}
+			if tt.wantCalls > 1 {
+				<-cancelled
+			}
+			for deadline := time.Now().Add(time.Second); len(requestSlots) != 1; {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d request slots taken after the hedge, want 1", len(requestSlots))
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestHedgedDoFirstRequestFailing(t *testing.T) {
+	defer func() { requestSlots = nil }()
+	errReset := xerrors.New("connection reset by peer")
+
+	tests := []struct {
+		name      string
+		hedgeFail bool
+		wantErr   bool
+	}{
+		{"hedge succeeds", false, false},
+		{"both fail", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMaxConcurrency(2)
+			release, err := acquireRequestSlot(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			var calls int32
+			client := &http.Client{
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt32(&calls, 1) == 1 {
+						// Fails once the hedge is on its way, but before it
+						// answers.
+						time.Sleep(20 * time.Millisecond)
+						return nil, errReset
+					}
+					time.Sleep(50 * time.Millisecond)
+					if tt.hedgeFail {
+						return nil, errReset
+					}
+					return okResponse(req), nil
+				}),
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "https://api.github.com/orgs/acme/settings/billing/actions", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := hedgedDo(client, req, 5*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("hedgedDo error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("status = %d, want the hedge's 200", resp.StatusCode)
+				}
+				resp.Body.Close()
+			}
+
+			if got := atomic.LoadInt32(&calls); got != 2 {
+				t.Errorf("sent %d requests, want 2", got)
+			}
+			if n := len(requestSlots); n != 1 {
+				t.Errorf("%d request slots taken after the hedge, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type installationRepositories struct {
+	TotalCount   int `json:"total_count"`
+	Repositories []struct {
+		FullName string `json:"full_name"`
+	} `json:"repositories"`
+}
+
+// accessibleRepositories drops the configured repositories a GitHub App
+// installation token can't read, so that an app installed on a subset of
+// the repositories doesn't fail on every cycle for the rest of them.
+// Other tokens are trusted as is.
+func accessibleRepositories(ctx context.Context, client *http.Client, args *Args) []string {
+	if !strings.HasPrefix(args.Token, "ghs_") {
+		return args.Repositories
+	}
+
+	accessible := make(map[string]bool)
+	for page := 1; ; page++ {
+		var p installationRepositories
+		path := fmt.Sprintf("/installation/repositories?per_page=100&page=%d", page)
+		if err := fetch(ctx, client, path, args, &p); err != nil {
+			log.Printf("Failed to list installation repositories, scraping all configured repositories: %v\n", err)
+			return args.Repositories
+		}
+
+		for _, r := range p.Repositories {
+			accessible[strings.ToLower(r.FullName)] = true
+		}
+		if len(p.Repositories) < 100 || len(accessible) >= p.TotalCount {
+			break
+		}
+	}
+
+	var repositories []string
+	for _, r := range args.Repositories {
+		if !accessible[strings.ToLower(r)] {
+			log.Printf("Skipped repository %s: not accessible to the GitHub App installation\n", r)
+			continue
+		}
+		repositories = append(repositories, r)
+	}
+
+	return repositories
+}
+
+// limitRepositories keeps the first args.MaxRepoSeries repositories, so a
+// long list doesn't explode the cardinality of the per-repository series.
+// The others aren't collected at all, saving their requests.
+func limitRepositories(repositories []string, args *Args) []string {
+	if args.MaxRepoSeries <= 0 || len(repositories) <= args.MaxRepoSeries {
+		return repositories
+	}
+
+	dropped := repositories[args.MaxRepoSeries:]
+	log.Printf("WARNING: collecting only %d of %d repositories, skipped %s\n", args.MaxRepoSeries, len(repositories), strings.Join(dropped, ","))
+	repoSeriesDroppedCounter.Add(float64(len(dropped)))
+
+	return repositories[:args.MaxRepoSeries]
+}
@@ -0,0 +1,175 @@
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/xerrors"
+)
+
+// OTLP/HTTP accepts the JSON encoding of ExportMetricsServiceRequest, which
+// spares the OpenTelemetry SDK and its gRPC dependencies.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpCumulative = 2
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func newOTLPAttribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// pushOTLP pushes the gathered gauges and counters every refresh interval,
+// so the values computed by the collectors are shared with /metrics rather
+// than requested from GitHub again. Histograms are left to Prometheus.
+func pushOTLP(ctx context.Context, args *Args) {
+	interval := time.Duration(args.Refresh) * time.Second
+	if interval < minRefresh {
+		interval = minRefresh
+	}
+	endpoint := strings.TrimSuffix(args.OTLPEndpoint, "/") + "/v1/metrics"
+	client := &http.Client{Timeout: args.ScrapeTimeout}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := exportOTLP(ctx, client, endpoint, prometheus.DefaultGatherer, now); err != nil {
+				log.Printf("Failed to push metrics to %s: %v\n", endpoint, err)
+			}
+		}
+	}
+}
+
+func exportOTLP(ctx context.Context, client *http.Client, endpoint string, g prometheus.Gatherer, now time.Time) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(otlpRequestFrom(families, now))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return xerrors.Errorf("POST %s: %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+func otlpRequestFrom(families []*dto.MetricFamily, now time.Time) *otlpRequest {
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, f := range families {
+		var points []otlpDataPoint
+		for _, m := range f.Metric {
+			var value float64
+			switch f.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+
+			p := otlpDataPoint{TimeUnixNano: timestamp, AsDouble: value}
+			for _, l := range m.Label {
+				p.Attributes = append(p.Attributes, newOTLPAttribute(l.GetName(), l.GetValue()))
+			}
+			points = append(points, p)
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		metric := otlpMetric{Name: f.GetName(), Description: f.GetHelp()}
+		if f.GetType() == dto.MetricType_COUNTER {
+			metric.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		} else {
+			metric.Gauge = &otlpGauge{DataPoints: points}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return &otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: []otlpAttribute{newOTLPAttribute("service.name", "github-billing-exporter")}},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "github-billing-exporter"}, Metrics: metrics}},
+	}}}
+}
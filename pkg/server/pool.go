@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+)
+
+// requestSlots bounds the requests in flight across all collectors, so
+// hundreds of owners don't open as many connections to the GitHub API.
+var requestSlots chan struct{}
+
+func setMaxConcurrency(n int) {
+	requestSlots = make(chan struct{}, n)
+	workerPoolSizeGauge.Set(float64(n))
+}
+
+// acquireRequestSlot waits for a free slot and counts the request as in
+// flight until release is called. Without a pool requests are unbounded.
+func acquireRequestSlot(ctx context.Context) (release func(), err error) {
+	slots := requestSlots
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	inflightRequestsGauge.Inc()
+
+	return releaseRequestSlot(slots), nil
+}
+
+// releaseRequestSlot frees a slot of the pool it was taken from, even if
+// setMaxConcurrency replaced the pool in the meantime.
+func releaseRequestSlot(slots chan struct{}) func() {
+	return func() {
+		inflightRequestsGauge.Dec()
+		if slots != nil {
+			<-slots
+		}
+	}
+}
+
+// tryAcquireRequestSlot is acquireRequestSlot without waiting, false if every
+// slot is taken.
+func tryAcquireRequestSlot() (release func(), ok bool) {
+	slots := requestSlots
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	inflightRequestsGauge.Inc()
+
+	return releaseRequestSlot(slots), true
+}
@@ -0,0 +1,135 @@
+// https://docs.github.com/en/rest/overview/resources-in-the-rest-api#rate-limiting
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitReserve is the fraction of a rate limit window left untouched, once
+// the remaining requests drop below it the next cycles wait for the reset.
+const rateLimitReserve = 0.1
+
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// rateLimitKey is a rate limit resource of an owner. Owners may authenticate
+// with their own token, so each of them has its own rate limits.
+type rateLimitKey struct {
+	owner    string
+	resource string
+}
+
+// rateLimits holds the latest X-RateLimit-* headers per owner and resource,
+// REST requests count against "core" and GraphQL queries against "graphql".
+var rateLimits = struct {
+	sync.Mutex
+	m map[rateLimitKey]rateLimit
+}{m: make(map[rateLimitKey]rateLimit)}
+
+func recordRateLimit(owner string, h http.Header) {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	resource := h.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+
+	rateLimits.Lock()
+	rateLimits.m[rateLimitKey{owner: owner, resource: resource}] = rateLimit{limit: limit, remaining: remaining, reset: time.Unix(reset, 0)}
+	ratio, ok := usedRatio(owner)
+	rateLimits.Unlock()
+
+	rateLimitLimitGauge.WithLabelValues(owner, resource).Set(float64(limit))
+	rateLimitRemainingGauge.WithLabelValues(owner, resource).Set(float64(remaining))
+	if ok {
+		rateLimitUsedRatioGauge.WithLabelValues(owner).Set(ratio)
+	}
+}
+
+// usedRatio is the fraction used of the owner's rate limit closest to being
+// exhausted, REST or GraphQL. rateLimits has to be locked.
+func usedRatio(owner string) (float64, bool) {
+	var ratio float64
+	ok := false
+	for key, rl := range rateLimits.m {
+		if key.owner != owner || rl.limit <= 0 {
+			continue
+		}
+		if r := float64(rl.limit-rl.remaining) / float64(rl.limit); !ok || r > ratio {
+			ratio, ok = r, true
+		}
+	}
+
+	return ratio, ok
+}
+
+// exhaustedRateLimit returns a resource with fewer than threshold requests
+// or points remaining until its window resets, or false unless every owner
+// has one. Owners whose token has requests left can still be refreshed.
+func exhaustedRateLimit(threshold int, now time.Time) (rateLimitKey, bool) {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	exhausted := make(map[string]rateLimitKey)
+	owners := make(map[string]bool)
+	for key, rl := range rateLimits.m {
+		owners[key.owner] = true
+		if rl.remaining < threshold && rl.reset.After(now) {
+			exhausted[key.owner] = key
+		}
+	}
+	if len(owners) == 0 || len(exhausted) < len(owners) {
+		return rateLimitKey{}, false
+	}
+
+	names := make([]string, 0, len(exhausted))
+	for owner := range exhausted {
+		names = append(names, owner)
+	}
+	sort.Strings(names)
+
+	return exhausted[names[0]], true
+}
+
+// endpointResource returns the rate limit resource an endpoint is billed to.
+func endpointResource(endpoint string) string {
+	if endpoint == "licenses" || endpoint == "lfs" {
+		return "graphql"
+	}
+
+	return "core"
+}
+
+// schedulerDelay is how much longer than the refresh interval the next cycle
+// of an owner's resource has to wait to keep its rate limit from being
+// exhausted.
+func schedulerDelay(owner, resource string, now time.Time) time.Duration {
+	rateLimits.Lock()
+	rl, ok := rateLimits.m[rateLimitKey{owner: owner, resource: resource}]
+	rateLimits.Unlock()
+
+	var delay time.Duration
+	if ok && float64(rl.remaining) < float64(rl.limit)*rateLimitReserve && rl.reset.After(now) {
+		delay = rl.reset.Sub(now)
+	}
+	schedulerDelaySecondsGauge.WithLabelValues(owner, resource).Set(delay.Seconds())
+
+	return delay
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitHeader(remaining int, reset time.Time) http.Header {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	h.Set("X-RateLimit-Resource", "core")
+	return h
+}
+
+func TestRateLimitsPerOwner(t *testing.T) {
+	rateLimits.Lock()
+	rateLimits.m = make(map[rateLimitKey]rateLimit)
+	rateLimits.Unlock()
+
+	now := time.Now()
+	reset := now.Add(30 * time.Minute)
+	recordRateLimit("acme", rateLimitHeader(10, reset))
+	recordRateLimit("beta", rateLimitHeader(4000, reset))
+
+	if d := schedulerDelay("acme", "core", now); d <= 0 {
+		t.Errorf("schedulerDelay(acme) = %v, want the time until the reset", d)
+	}
+	if d := schedulerDelay("beta", "core", now); d != 0 {
+		t.Errorf("schedulerDelay(beta) = %v, want 0 as its token has requests left", d)
+	}
+	if key, ok := exhaustedRateLimit(100, now); ok {
+		t.Errorf("exhaustedRateLimit = %v, want none while beta has requests left", key)
+	}
+
+	recordRateLimit("beta", rateLimitHeader(50, reset))
+	key, ok := exhaustedRateLimit(100, now)
+	if !ok || key != (rateLimitKey{owner: "acme", resource: "core"}) {
+		t.Errorf("exhaustedRateLimit = %v, %v, want acme core", key, ok)
+	}
+}
+
+func TestUsedRatioOfResourceClosestToExhaustion(t *testing.T) {
+	rateLimits.Lock()
+	rateLimits.m = make(map[rateLimitKey]rateLimit)
+	rateLimits.Unlock()
+
+	reset := time.Now().Add(time.Hour)
+	recordRateLimit("acme", rateLimitHeader(4000, reset))
+	graphql := rateLimitHeader(1000, reset)
+	graphql.Set("X-RateLimit-Resource", "graphql")
+	recordRateLimit("acme", graphql)
+	recordRateLimit("beta", rateLimitHeader(5000, reset))
+
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+	for owner, want := range map[string]float64{"acme": 0.8, "beta": 0} {
+		if got, ok := usedRatio(owner); !ok || got != want {
+			t.Errorf("usedRatio(%s) = %v, %v, want %v", owner, got, ok, want)
+		}
+	}
+	if _, ok := usedRatio("gamma"); ok {
+		t.Error("usedRatio(gamma) reported a ratio without any response")
+	}
+}
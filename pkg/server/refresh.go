@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// minRefresh is the shortest interval a jittered refresh is shortened to.
+const minRefresh = 10 * time.Second
+
+// jitterRand is seeded per process so instances started together don't
+// share the same jitter sequence.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func randFloat64() float64 {
+	jitterRand.Lock()
+	defer jitterRand.Unlock()
+
+	return jitterRand.Float64()
+}
+
+// nextInterval is how long to wait for the next cycle, until the next time
+// of args.Schedule if it is set. The next time is computed from now, so
+// times missed while a cycle ran long or the process was stopped are
+// skipped instead of caught up on.
+func nextInterval(args *Args, now time.Time, rnd func() float64) time.Duration {
+	if args.Schedule == "" {
+		return refreshInterval(args, rnd)
+	}
+
+	// The schedule has been checked by Args.Validate.
+	schedule, err := cron.ParseStandard(args.Schedule)
+	if err != nil {
+		return refreshInterval(args, rnd)
+	}
+
+	return schedule.Next(now).Sub(now)
+}
+
+// refreshInterval spreads the refresh interval by up to ±args.RefreshJitter,
+// rnd returns a number in [0, 1) and is a parameter for deterministic tests.
+func refreshInterval(args *Args, rnd func() float64) time.Duration {
+	refresh := time.Duration(args.Refresh) * time.Second
+	if args.RefreshJitter == 0 {
+		return refresh
+	}
+
+	d := time.Duration(float64(refresh) * (1 + args.RefreshJitter*(2*rnd()-1)))
+	if d < minRefresh {
+		return minRefresh
+	}
+
+	return d
+}
+
+// refreshTriggers holds a channel per collection loop, keyed by owner label,
+// to start its next cycle right away.
+var refreshTriggers = struct {
+	sync.Mutex
+	m map[string]map[chan struct{}]bool
+}{m: make(map[string]map[chan struct{}]bool)}
+
+// subscribeRefresh returns the trigger of a loop of owner. It is buffered,
+// so triggers arriving while a cycle runs collapse into one more cycle.
+func subscribeRefresh(owner string) (trigger chan struct{}, unsubscribe func()) {
+	trigger = make(chan struct{}, 1)
+
+	refreshTriggers.Lock()
+	defer refreshTriggers.Unlock()
+
+	if refreshTriggers.m[owner] == nil {
+		refreshTriggers.m[owner] = make(map[chan struct{}]bool)
+	}
+	refreshTriggers.m[owner][trigger] = true
+
+	return trigger, func() {
+		refreshTriggers.Lock()
+		defer refreshTriggers.Unlock()
+
+		delete(refreshTriggers.m[owner], trigger)
+	}
+}
+
+// triggerRefresh starts the next cycle of the loops of owner, or of all of
+// them if owner is empty, and returns how many were triggered.
+func triggerRefresh(owner string) int {
+	refreshTriggers.Lock()
+	defer refreshTriggers.Unlock()
+
+	n := 0
+	for o, triggers := range refreshTriggers.m {
+		if owner != "" && o != owner {
+			continue
+		}
+		for trigger := range triggers {
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+			n++
+		}
+	}
+
+	return n
+}
+
+// refreshHandler serves POST /refresh?owner=acme, refreshing the owner, or
+// every owner without the parameter, out of band. The cycles run in the
+// background, the handler answers once they are triggered.
+func refreshHandler(args *Args) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if args.RefreshBasicAuth != "" {
+			user, password, ok := req.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(args.RefreshBasicAuth)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="github-billing-exporter"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		owner := strings.TrimSpace(req.URL.Query().Get("owner"))
+		n := triggerRefresh(owner)
+		if n == 0 && owner != "" {
+			http.Error(w, fmt.Sprintf("unknown owner %s", owner), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "refreshing %d collectors\n", n)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rollup sums the latest value of every owner into a single gauge. The
+// gauge is a vector without labels so nothing is exported until the first
+// value is set.
+type rollup struct {
+	mu     sync.Mutex
+	values map[string]float64
+	gauge  *prometheus.GaugeVec
+}
+
+func newRollup(name, help string) *rollup {
+	return &rollup{
+		values: make(map[string]float64),
+		gauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: name,
+				Help: help,
+			},
+			nil,
+		),
+	}
+}
+
+func (r *rollup) set(owner string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values[owner] = v
+
+	var sum float64
+	for _, v := range r.values {
+		sum += v
+	}
+	r.gauge.WithLabelValues().Set(sum)
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,19 +18,133 @@ import (
 	"golang.org/x/xerrors"
 )
 
+var debug bool
+
+// logf logs with the owner and endpoint of the collection cycle ctx belongs
+// to, if any, e.g. "[acme actions] ", so the lines of concurrent cycles can
+// be told apart.
+func logf(ctx context.Context, format string, v ...interface{}) {
+	var tags []string
+	if owner, ok := ownerFromContext(ctx); ok {
+		tags = append(tags, owner)
+	}
+	if endpoint, ok := endpointFromContext(ctx); ok {
+		tags = append(tags, endpoint)
+	}
+	if len(tags) > 0 {
+		format = "[" + strings.Join(tags, " ") + "] " + format
+	}
+
+	log.Printf(format, v...)
+}
+
+func debugf(ctx context.Context, format string, v ...interface{}) {
+	if debug {
+		logf(ctx, format, v...)
+	}
+}
+
 func Run(args *Args) error {
-	var mode apiMode
-	if args.Organization != "" {
-		mode = orgMode
-	} else if args.User != "" {
-		mode = userMode
+	debug = args.Debug
+
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	if err := args.readOwnerTokenFiles(); err != nil {
+		return err
+	}
+	if strings.HasPrefix(args.BaseURL, "http:") {
+		log.Printf("WARNING: base URL %s is plain HTTP, the token is sent unencrypted\n", args.BaseURL)
 	}
 
-	go getGitHubActionsBilling(mode, args)
-	go getGitHubPackagesBilling(mode, args)
-	go getGitHubSharedStorageBilling(mode, args)
+	if args.Refresh <= 0 {
+		// A zero interval would make the collectors poll GitHub in a tight loop.
+		log.Printf("WARNING: refresh %d is not positive, refreshing every %v instead\n", args.Refresh, minRefresh)
+		args.Refresh = int(minRefresh / time.Second)
+	}
+
+	if isWorkflowToken(args) {
+		log.Printf("Running in GitHub Actions with a workflow token, endpoints it can't read are skipped after their first 403\n")
+	}
+
+	endpoints, err := registerMetrics(args)
+	if err != nil {
+		return err
+	}
+
+	setMaxConcurrency(args.MaxConcurrency)
 
 	ctx, cancel := context.WithCancel(context.Background())
+	client := newHTTPClient(args)
+
+	if args.AutoDiscoverOrgs {
+		discoverCtx, cancelDiscover := context.WithTimeout(ctx, args.ScrapeTimeout)
+		organizations, err := discoverOrganizations(discoverCtx, client, args)
+		cancelDiscover()
+		if err != nil {
+			cancel()
+			return err
+		}
+		args.Organization = addOrganizations(args.Organization, organizations)
+		if err := args.checkOwnerLabels(); err != nil {
+			cancel()
+			return err
+		}
+		log.Printf("Collecting organizations: %s\n", strings.Join(args.Organization, ","))
+	}
+
+	startTimeGauge.SetToCurrentTime()
+	targetInfoGauge.WithLabelValues(redactedURL(args.BaseURL)).Set(1)
+
+	owners := args.owners()
+	ownersTotalGauge.Set(float64(len(owners)))
+
+	for _, o := range owners {
+		o := o
+		ownerInfoGauge.WithLabelValues(args.label(o), o.mode.String()).Set(1)
+
+		if endpoints["actions"] {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubActionsBilling(ctx, client, o, args) })
+		}
+		if endpoints["packages"] {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubPackagesBilling(ctx, client, o, args) })
+		}
+		if endpoints["shared_storage"] {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubSharedStorageBilling(ctx, client, o, args) })
+		}
+		if endpoints["copilot"] && o.mode == orgMode {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubCopilotSeats(ctx, client, o, args) })
+		}
+		if endpoints["billing_info"] && o.mode == orgMode {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubBillingInfo(ctx, client, o, args) })
+		}
+		if endpoints["budgets"] && o.mode != userMode {
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubSpendingLimit(ctx, client, o, args) })
+		}
+	}
+
+	if len(args.Repositories) > 0 && endpoints["cache"] {
+		for _, r := range limitRepositories(accessibleRepositories(ctx, client, args), args) {
+			r := r
+			go supervise(ctx, args, func(ctx context.Context) { getGitHubActionsCacheUsage(ctx, client, r, args) })
+		}
+	}
+
+	if args.CostCenterEnterprise != "" && endpoints["cost_centers"] {
+		go supervise(ctx, args, func(ctx context.Context) { getGitHubCostCenterBilling(ctx, client, args) })
+	}
+
+	if args.GraphQLEnterprise != "" && endpoints["licenses"] {
+		go supervise(ctx, args, func(ctx context.Context) { getGitHubEnterpriseLicenses(ctx, client, args) })
+	}
+
+	if args.GraphQLEnterprise != "" && endpoints["lfs"] {
+		go supervise(ctx, args, func(ctx context.Context) { getGitHubLFSBilling(ctx, client, args) })
+	}
+
+	if args.OTLPEndpoint != "" {
+		go pushOTLP(ctx, args)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
@@ -36,6 +152,35 @@ func Run(args *Args) error {
 	})
 	mux.Handle("/metrics", promhttp.Handler())
 
+	// Admin endpoints share the metrics port unless they are given their own
+	// address, e.g. one bound to localhost.
+	adminMux := mux
+	if args.AdminListenAddress != "" {
+		adminMux = http.NewServeMux()
+	}
+	adminMux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "ok")
+	})
+	adminMux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		if args.ReadyOnRateLimit {
+			if key, ok := exhaustedRateLimit(args.ReadyRateLimitThreshold, time.Now()); ok {
+				http.Error(w, fmt.Sprintf("%s rate limit of every owner nearly exhausted, e.g. %s", key.resource, key.owner), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintf(w, "ok")
+	})
+	if args.EnableRefresh {
+		adminMux.HandleFunc("/refresh", refreshHandler(args))
+	}
+	if args.EnablePprof {
+		adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+		adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
 	httpServer := &http.Server{
 		Addr:        ":" + strconv.Itoa(args.Port),
 		Handler:     mux,
@@ -50,6 +195,21 @@ func Run(args *Args) error {
 		}
 	}()
 
+	var adminServer *http.Server
+	if args.AdminListenAddress != "" {
+		adminServer = &http.Server{
+			Addr:        args.AdminListenAddress,
+			Handler:     adminMux,
+			BaseContext: func(_ net.Listener) context.Context { return ctx },
+		}
+
+		go func() {
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("Admin HTTP server ListenAndServe: %v\n", err)
+			}
+		}()
+	}
+
 	signalChan := make(chan os.Signal, 1)
 
 	signal.Notify(
@@ -58,6 +218,9 @@ func Run(args *Args) error {
 		syscall.SIGINT,
 		syscall.SIGQUIT,
 	)
+	// A second signal during the shutdown terminates, but not once Run has
+	// returned.
+	defer signal.Stop(signalChan)
 
 	<-signalChan
 	log.Print("os.Interrupt - shutting down...\n")
@@ -70,6 +233,11 @@ func Run(args *Args) error {
 	gracefullCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelShutdown()
 
+	if adminServer != nil {
+		if err := adminServer.Shutdown(gracefullCtx); err != nil {
+			return xerrors.Errorf("admin shutdown error: %v\n", err)
+		}
+	}
 	if err := httpServer.Shutdown(gracefullCtx); err != nil {
 		return xerrors.Errorf("shutdown error: %v\n", err)
 	}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nashiox/github-billing-exporter/pkg/mockgithub"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// TestRunEndToEnd runs the exporter against pkg/mockgithub and checks what
+// /metrics serves once the first cycles are done, covering the registration,
+// the collector loops and the handler together.
+func TestRunEndToEnd(t *testing.T) {
+	gh := mockgithub.New(map[string]*mockgithub.Owner{
+		"acme": mockgithub.OrgWithOverage(),
+		// An organization without Packages billing fails that collector.
+		"beta": mockgithub.OrgWithoutPackages(),
+	})
+	defer gh.Close()
+
+	port := freePort(t)
+	args := &Args{
+		Port:                  port,
+		Refresh:               3600,
+		ScrapeTimeout:         10 * time.Second,
+		Organization:          []string{"acme", "beta"},
+		BaseURL:               gh.URL,
+		Token:                 "x",
+		AcceptHeader:          "application/vnd.github+json",
+		MaxResponseBytes:      1 << 20,
+		MaxConcurrency:        4,
+		EmitLegacyMetricNames: true,
+		// budgets stays off by default.
+		Collectors: map[string]bool{"copilot": true},
+	}
+
+	// Run stops on SIGINT, which must not end the test binary should it
+	// arrive before Run listens for it.
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, syscall.SIGINT)
+	defer signal.Stop(interrupted)
+
+	// The first cycles are told done by their scrape success, which earlier
+	// tests may have left behind.
+	scrapeSuccessGauge.Reset()
+
+	done := make(chan error, 1)
+	go func() { done <- Run(args) }()
+
+	metricsURL := "http://127.0.0.1:" + strconv.Itoa(port) + "/metrics"
+	firstCycles := []string{
+		`github_billing_scrape_success{endpoint="actions",owner="acme"}`,
+		`github_billing_scrape_success{endpoint="packages",owner="acme"}`,
+		`github_billing_scrape_success{endpoint="shared_storage",owner="acme"}`,
+		`github_billing_scrape_success{endpoint="actions",owner="beta"}`,
+		`github_billing_scrape_success{endpoint="packages",owner="beta"}`,
+		`github_billing_scrape_success{endpoint="shared_storage",owner="beta"}`,
+		`github_billing_scrape_success{endpoint="copilot",owner="acme"}`,
+		`github_billing_scrape_success{endpoint="copilot",owner="beta"}`,
+		`github_billing_scrape_success{endpoint="billing_info",owner="acme"}`,
+		`github_billing_scrape_success{endpoint="billing_info",owner="beta"}`,
+	}
+	var body string
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		select {
+		case err := <-done:
+			t.Fatalf("Run returned before the first cycles: %v", err)
+		default:
+		}
+
+		body = scrape(t, metricsURL)
+		cycled := 0
+		for _, s := range firstCycles {
+			if strings.Contains(body, s+" ") {
+				cycled++
+			}
+		}
+		if cycled == len(firstCycles) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first cycles not done within 10s, /metrics served:\n%s", body)
+		}
+	}
+
+	for _, family := range []string{
+		"# TYPE actions_total_minutes_used gauge",
+		"# TYPE actions_minutes_used_breakdown gauge",
+		"# TYPE packages_total_gigabytes_bandwidth_used gauge",
+		"# TYPE shared_storage_estimated_storage_for_month gauge",
+		"# TYPE total_minutes_used gauge",
+		"# TYPE copilot_seats gauge",
+		"# TYPE github_org_billing_info gauge",
+		"# TYPE github_billing_up gauge",
+	} {
+		if !strings.Contains(body, family+"\n") {
+			t.Errorf("/metrics is missing %q", family)
+		}
+	}
+	for _, sample := range []string{
+		`actions_total_minutes_used{owner="acme"} 3500`,
+		`actions_total_paid_minutes_used{owner="acme"} 500`,
+		`actions_included_minutes{owner="acme"} 3000`,
+		`actions_minutes_used_breakdown{os="macos",owner="acme"} 200`,
+		`actions_minutes_used_breakdown{os="windows",owner="beta"} 0`,
+		`packages_total_paid_gigabytes_bandwidth_used{owner="acme"} 10`,
+		`shared_storage_days_left_in_billing_cycle{owner="beta"} 20`,
+		`total_minutes_used{owner="acme"} 3500`,
+		`github_billing_scrape_success{endpoint="packages",owner="acme"} 1`,
+		`github_billing_scrape_success{endpoint="packages",owner="beta"} 0`,
+		`github_billing_endpoint_accessible{endpoint="packages",owner="beta"} 0`,
+		`copilot_seats{owner="acme",plan_type="business"} 12`,
+		`github_org_billing_info{billing_email="billing@acme.example",owner="acme"} 1`,
+		// beta has no Copilot subscription and hides its billing email,
+		// both skipped rather than failed.
+		`github_billing_scrape_success{endpoint="copilot",owner="beta"} 1`,
+		`github_billing_endpoint_accessible{endpoint="copilot",owner="beta"} 0`,
+		`github_billing_scrape_success{endpoint="billing_info",owner="beta"} 1`,
+		`github_billing_up{owner="acme"} 1`,
+		`github_billing_up{owner="beta"} 0`,
+	} {
+		if !strings.Contains(body, sample+"\n") {
+			t.Errorf("/metrics is missing %q", sample)
+		}
+	}
+
+	for _, absent := range []string{
+		`github_billing_scrape_success{endpoint="budgets"`,
+		`github_org_billing_info{billing_email="",owner="beta"}`,
+	} {
+		if strings.Contains(body, absent) {
+			t.Errorf("/metrics has %q", absent)
+		}
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Run didn't stop within 10s of SIGINT")
+	}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var textfileMu sync.Mutex
+
+// writeTextfile writes all metrics for node_exporter's textfile collector, in
+// air-gapped networks where Prometheus can't scrape the exporter. The file is
+// written to a temporary file and renamed, so it is never read half written.
+func writeTextfile(args *Args) {
+	textfileMu.Lock()
+	defer textfileMu.Unlock()
+
+	if err := prometheus.WriteToTextfile(args.TextfileOutput, prometheus.DefaultGatherer); err != nil {
+		log.Printf("Failed to write metrics to %s: %v\n", args.TextfileOutput, err)
+	}
+}
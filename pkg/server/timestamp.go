@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// responseDates holds the Date header of the latest response per owner.
+var responseDates = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+func setResponseDate(owner string, t time.Time) {
+	responseDates.Lock()
+	defer responseDates.Unlock()
+
+	responseDates.m[owner] = t
+}
+
+func responseDate(owner string) (time.Time, bool) {
+	responseDates.Lock()
+	defer responseDates.Unlock()
+
+	t, ok := responseDates.m[owner]
+	return t, ok
+}
+
+// timestampCollector timestamps the metrics of a collector with the time
+// GitHub answered for their owner. Metrics without an owner label, or whose
+// owner hasn't been answered for yet, are passed on with the scrape time.
+type timestampCollector struct {
+	prometheus.Collector
+}
+
+func (c timestampCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			ch <- m
+			continue
+		}
+
+		for _, l := range pb.Label {
+			if l.GetName() != "owner" {
+				continue
+			}
+			if t, ok := responseDate(l.GetValue()); ok {
+				m = prometheus.NewMetricWithTimestamp(t, m)
+			}
+			break
+		}
+		ch <- m
+	}
+}
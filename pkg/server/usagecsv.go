@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// usageCSV is the usage report in its CSV form, requested with
+// --usage-format csv as some GitHub Enterprise Server versions only offer
+// that one. The columns are matched by their header, e.g. "Net Amount ($)"
+// or "netAmount", so their order doesn't matter.
+type usageCSV struct {
+	UsageItems []usageItem
+}
+
+func (u *usageCSV) unmarshalBody(body []byte) error {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return xerrors.Errorf("reading usage CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[usageCSVColumn(name)] = i
+	}
+	for _, name := range []string{"product", "quantity", "netamount"} {
+		if _, ok := columns[name]; !ok {
+			return xerrors.Errorf("usage CSV has no %s column", name)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("reading usage CSV: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) (float64, error) {
+			s := strings.NewReplacer("$", "", ",", "").Replace(field(name))
+			if s == "" {
+				return 0, nil
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, xerrors.Errorf("line %d: invalid %s %q: %w", line, name, field(name), err)
+			}
+			return f, nil
+		}
+
+		item := usageItem{
+			Date:             field("date"),
+			Product:          field("product"),
+			SKU:              field("sku"),
+			UnitType:         field("unittype"),
+			OrganizationName: field("organization"),
+			RepositoryName:   field("repository"),
+		}
+		for name, f := range map[string]*float64{
+			"quantity":       &item.Quantity,
+			"priceperunit":   &item.PricePerUnit,
+			"grossamount":    &item.GrossAmount,
+			"discountamount": &item.DiscountAmount,
+			"netamount":      &item.NetAmount,
+		} {
+			if *f, err = number(name); err != nil {
+				return err
+			}
+		}
+		u.UsageItems = append(u.UsageItems, item)
+	}
+}
+
+// usageCSVColumn normalizes a header, e.g. "Net Amount ($)" to netamount,
+// "organizationName" to organization.
+func usageCSVColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	name = strings.TrimSpace(strings.TrimSuffix(name, "($)"))
+	name = strings.NewReplacer(" ", "", "_", "").Replace(name)
+
+	return strings.TrimSuffix(name, "name")
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var wantUsageItems = []usageItem{
+	{Date: "2024-05-01", Product: "actions", SKU: "Actions Linux", Quantity: 1200, UnitType: "Minutes", PricePerUnit: 0.008, GrossAmount: 9.6, NetAmount: 0, OrganizationName: "acme", RepositoryName: "acme/app"},
+	{Date: "2024-05-01", Product: "actions", SKU: "Actions macOS 3-core", Quantity: 20, UnitType: "Minutes", PricePerUnit: 0.08, GrossAmount: 1.6, DiscountAmount: 0.6, NetAmount: 1, OrganizationName: "acme", RepositoryName: "acme/ios"},
+}
+
+const usageJSON = `{"usageItems":[
+{"date":"2024-05-01","product":"actions","sku":"Actions Linux","quantity":1200,"unitType":"Minutes","pricePerUnit":0.008,"grossAmount":9.6,"discountAmount":0,"netAmount":0,"organizationName":"acme","repositoryName":"acme/app"},
+{"date":"2024-05-01","product":"actions","sku":"Actions macOS 3-core","quantity":20,"unitType":"Minutes","pricePerUnit":0.08,"grossAmount":1.6,"discountAmount":0.6,"netAmount":1,"organizationName":"acme","repositoryName":"acme/ios"}]}`
+
+// The report starts with a byte order mark.
+const usageCSVBody = "\ufeffDate,Product,SKU,Quantity,Unit Type,Price Per Unit ($),Gross Amount ($),Discount Amount ($),Net Amount ($),Organization,Repository\n" +
+	"2024-05-01,actions,Actions Linux,\"1,200\",Minutes,$0.008,$9.60,$0.00,$0.00,acme,acme/app\n" +
+	"2024-05-01,actions,Actions macOS 3-core,20,Minutes,$0.08,$1.60,$0.60,$1.00,acme,acme/ios\n"
+
+func TestUsageCSVUnmarshalBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []usageItem
+		wantErr bool
+	}{
+		{name: "report", body: usageCSVBody, want: wantUsageItems},
+		{
+			name: "camel case columns in another order",
+			body: "netAmount,quantity,product,organizationName\n1.5,3,packages,acme\n",
+			want: []usageItem{{Product: "packages", Quantity: 3, NetAmount: 1.5, OrganizationName: "acme"}},
+		},
+		{name: "header only", body: "Product,Quantity,Net Amount ($)\n"},
+		{name: "missing column", body: "Product,Quantity\nactions,1\n", wantErr: true},
+		{name: "invalid number", body: "Product,Quantity,Net Amount ($)\nactions,many,$1.00\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u usageCSV
+			err := u.unmarshalBody([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unmarshalBody error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(u.UsageItems, tt.want) {
+				t.Errorf("unmarshalBody = %+v, want %+v", u.UsageItems, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchUsageItemsFormats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.Header.Get("Accept"), "text/csv") {
+			w.Header().Set("Content-Type", "text/csv")
+			io.WriteString(w, usageCSVBody)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, usageJSON)
+	}))
+	defer srv.Close()
+
+	for _, format := range []string{"", "json", "csv"} {
+		t.Run("usage-format="+format, func(t *testing.T) {
+			args := &Args{BaseURL: srv.URL, Token: "x", AcceptHeader: "application/vnd.github+json", MaxResponseBytes: 1 << 20, UsageFormat: format}
+			items, err := fetchUsageItems(context.Background(), srv.Client(), "/organizations/acme/settings/billing/usage", args)
+			if err != nil {
+				t.Fatalf("fetchUsageItems: %v", err)
+			}
+			if !reflect.DeepEqual(items, wantUsageItems) {
+				t.Errorf("fetchUsageItems = %+v, want %+v", items, wantUsageItems)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// loopProgress is shared between a collector loop and its supervisor. The
+// loop reports by when it expects to make progress next.
+type loopProgress struct {
+	mu       sync.Mutex
+	owner    string
+	endpoint string
+	expected time.Time
+}
+
+type loopProgressKey struct{}
+
+func (p *loopProgress) expect(owner, endpoint string, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.owner, p.endpoint, p.expected = owner, endpoint, t
+}
+
+// reportProgress is called by poll, it is a no-op for unsupervised loops.
+func reportProgress(ctx context.Context, owner, endpoint string, next time.Time) {
+	if p, ok := ctx.Value(loopProgressKey{}).(*loopProgress); ok {
+		p.expect(owner, endpoint, next)
+	}
+}
+
+// supervise runs a collector loop and restarts it once it is more than three
+// refresh intervals late, e.g. blocked by a bug. A loop which can't be
+// cancelled is abandoned rather than waited for.
+func supervise(ctx context.Context, args *Args, run func(ctx context.Context)) {
+	refresh := time.Duration(args.Refresh) * time.Second
+	if refresh < minRefresh {
+		refresh = minRefresh
+	}
+
+	for {
+		progress := &loopProgress{expected: time.Now().Add(args.ScrapeTimeout)}
+		loopCtx, cancel := context.WithCancel(context.WithValue(ctx, loopProgressKey{}, progress))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			run(loopCtx)
+		}()
+
+		ticker := time.NewTicker(refresh)
+		stuck := false
+		for !stuck {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				cancel()
+				return
+			case <-done:
+				ticker.Stop()
+				cancel()
+				return
+			case now := <-ticker.C:
+				progress.mu.Lock()
+				stuck = now.After(progress.expected.Add(3 * refresh))
+				owner, endpoint := progress.owner, progress.endpoint
+				progress.mu.Unlock()
+
+				if stuck {
+					log.Printf("WARNING: %s billing collector for %s is stuck, restarting it\n", endpoint, owner)
+					collectorRestartsCounter.WithLabelValues(owner, endpoint).Inc()
+				}
+			}
+		}
+		ticker.Stop()
+		cancel()
+	}
+}